@@ -0,0 +1,95 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Amount is a quantity of coins counted in base units.
+type Amount int64
+
+const (
+	// AmountDecimals is the number of decimal places of a whole coin.
+	AmountDecimals = 8
+
+	Coin Amount = 100000000
+
+	// MaxMoney caps every output and every sum of outputs. Keeping sums
+	// below it also keeps them far away from overflowing an int64.
+	MaxMoney = 21000000 * Coin
+)
+
+// ParseAmount reads a decimal number of coins such as "1.25" into base units.
+func ParseAmount(s string) (Amount, error) {
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > AmountDecimals {
+		return 0, fmt.Errorf("amount %q has more than %d decimal places", s, AmountDecimals)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	frac += strings.Repeat("0", AmountDecimals-len(frac))
+
+	if strings.ContainsAny(whole+frac, "+-") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	coins, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || coins > int64(MaxMoney/Coin) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	units, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	amount := Amount(coins)*Coin + Amount(units)
+	if err := CheckAmount(amount); err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
+
+func (a Amount) String() string {
+	sign := ""
+	if a < 0 {
+		sign = "-"
+		a = -a
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, a/Coin, AmountDecimals, a%Coin)
+}
+
+// CheckAmount makes sure an amount is neither negative nor above MaxMoney.
+func CheckAmount(a Amount) error {
+	if a < 0 {
+		return errors.New("amount is negative")
+	}
+	if a > MaxMoney {
+		return errors.New("amount is above the maximum money supply")
+	}
+	return nil
+}
+
+// SumAmounts adds amounts, failing if any of them or the running total leaves
+// the valid range.
+func SumAmounts(amounts ...Amount) (Amount, error) {
+	var total Amount
+
+	for _, a := range amounts {
+		if err := CheckAmount(a); err != nil {
+			return 0, err
+		}
+		total += a
+		if err := CheckAmount(total); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
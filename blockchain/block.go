@@ -14,6 +14,24 @@ type Block struct {
 	PrevHash     []byte
 	Nonce        int
 	Height       int
+
+	// Version is 0 for blocks mined before timestamps were committed to by
+	// the header, BlockVersion for every block mined now.
+	Version int
+}
+
+// BlockVersion is the version of new blocks. Their header hash commits to
+// the version and the timestamp.
+const BlockVersion = 1
+
+// BlockHeader holds the fields of a block that its proof of work commits to.
+// It is enough to check a block's hash without having its transactions.
+type BlockHeader struct {
+	Version    int
+	Timestamp  int64
+	PrevHash   []byte
+	MerkleRoot []byte
+	Nonce      int
 }
 
 func Handle(err error) {
@@ -22,8 +40,8 @@ func Handle(err error) {
 	}
 }
 
-func CreateBlock(txs []*Transaction, prevHash []byte, height int) *Block {
-	block := &Block{time.Now().Unix(), []byte{}, txs, prevHash, 0, height}
+func CreateBlock(txs []*Transaction, prevHash []byte, height int, timestamp int64) *Block {
+	block := &Block{timestamp, []byte{}, txs, prevHash, 0, height, BlockVersion}
 	// Don't forget to add the 0 at the end for the nonce!
 	pow := NewProofOfWork(block)
 	nonce, hash := pow.Run()
@@ -35,7 +53,7 @@ func CreateBlock(txs []*Transaction, prevHash []byte, height int) *Block {
 }
 
 func Genesis(coinbase *Transaction) *Block {
-	return CreateBlock([]*Transaction{coinbase}, []byte{}, 0)
+	return CreateBlock([]*Transaction{coinbase}, []byte{}, 0, time.Now().Unix())
 }
 
 func (b *Block) Serialize() []byte {
@@ -54,6 +72,10 @@ func Deserialize(data []byte) *Block {
 	return &block
 }
 
+func (b *Block) Header() BlockHeader {
+	return BlockHeader{b.Version, b.Timestamp, b.PrevHash, b.HashTransactions(), b.Nonce}
+}
+
 // Takes all of the transactions existing in a block and hashes them.
 func (b *Block) HashTransactions() []byte {
 	var txHashes [][]byte
@@ -2,7 +2,6 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -12,6 +11,7 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/TualatinX/blockchain-go/wallet"
 	"github.com/dgraph-io/badger" // This is our database import
 )
 
@@ -25,6 +25,10 @@ const (
 	genesisData = "First Transaction from Genesis"
 )
 
+// CoinbaseMaturity is how many blocks must be mined on top of a coinbase
+// transaction before its outputs can be spent.
+var CoinbaseMaturity = 100
+
 type BlockChain struct {
 	// Blocks []*Block
 	LastHash []byte
@@ -44,6 +48,11 @@ func DBexists(path string) bool {
 	return true
 }
 
+// BlockChainExists tells whether the node has a blockchain database yet
+func BlockChainExists(nodeId string) bool {
+	return DBexists(fmt.Sprintf(dbPath, nodeId))
+}
+
 // InitBlockChain will be what starts a new blockChain
 func InitBlockChain(address, nodeId string) *BlockChain {
 	var lastHash []byte
@@ -53,6 +62,7 @@ func InitBlockChain(address, nodeId string) *BlockChain {
 		fmt.Println("Blockchain already exists")
 		runtime.Goexit()
 	}
+	removeFeeEstimates(nodeId)
 
 	opts := badger.DefaultOptions(path)
 	opts.Logger = nil
@@ -113,6 +123,30 @@ func ContinueBlockChain(nodeId string) *BlockChain {
 	return &chain
 }
 
+// UsedPubKeyHashes returns the hex encoded public key hashes that any output
+// in the chain has been locked to
+func (chain *BlockChain) UsedPubKeyHashes() map[string]bool {
+	used := make(map[string]bool)
+
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Outputs {
+				if !out.IsData() {
+					used[hex.EncodeToString(out.PubKeyHash)] = true
+				}
+			}
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	return used
+}
+
 // Find unspent outputs
 func (chain *BlockChain) FindUTXO() map[string]TxOutputs {
 	UTXO := make(map[string]TxOutputs)
@@ -128,6 +162,9 @@ func (chain *BlockChain) FindUTXO() map[string]TxOutputs {
 
 		Outputs:
 			for outIdx, out := range tx.Outputs {
+				if out.IsData() {
+					continue
+				}
 				if spentTXOs[txID] != nil {
 					for _, spentOut := range spentTXOs[txID] {
 						if spentOut == outIdx {
@@ -136,7 +173,10 @@ func (chain *BlockChain) FindUTXO() map[string]TxOutputs {
 					}
 				}
 				outs := UTXO[txID]
+				outs.Height = block.Height
+				outs.Coinbase = tx.IsCoinbase()
 				outs.Outputs = append(outs.Outputs, out)
+				outs.Indexes = append(outs.Indexes, outIdx)
 				UTXO[txID] = outs
 			}
 			if !tx.IsCoinbase() {
@@ -154,8 +194,18 @@ func (chain *BlockChain) FindUTXO() map[string]TxOutputs {
 	return UTXO
 }
 
-func (chain *BlockChain) AddBlock(block *Block) {
+// AddBlock validates a block received from a peer and stores it, moving the
+// tip if the block extends the longest chain.
+func (chain *BlockChain) AddBlock(block *Block) error {
 	var lastHash, lastBlockData []byte
+
+	if _, err := chain.GetBlock(block.Hash); err == nil {
+		return nil
+	}
+	if err := chain.ValidateBlock(block); err != nil {
+		return err
+	}
+
 	err := chain.Database.Update(func(txn *badger.Txn) error {
 		if _, err := txn.Get(block.Hash); err == nil {
 			return nil
@@ -192,18 +242,13 @@ func (chain *BlockChain) AddBlock(block *Block) {
 		return nil
 	})
 	Handle(err)
+	return nil
 }
 
 func (chain *BlockChain) MineBlock(transactions []*Transaction) *Block {
 	var lastHash, lastBlockData []byte
 	var lastHeight int
 
-	for _, tx := range transactions {
-		if !chain.VerifyTransaction(tx) {
-			log.Panic("Invalid Transaction")
-		}
-	}
-
 	err := chain.Database.View(func(txn *badger.Txn) error {
 
 		item, err := txn.Get([]byte("lh"))
@@ -229,7 +274,24 @@ func (chain *BlockChain) MineBlock(transactions []*Transaction) *Block {
 	})
 	Handle(err)
 
-	newBlock := CreateBlock(transactions, lastHash, lastHeight+1)
+	earlier := make(map[string]*Transaction)
+	for _, tx := range transactions {
+		if err := chain.ValidateTransactionWith(tx, lastHeight+1, earlier); err != nil {
+			log.Panicf("Invalid Transaction: %s", err)
+		}
+		if !tx.IsCoinbase() {
+			earlier[hex.EncodeToString(tx.ID)] = tx
+		}
+	}
+
+	// The block must be later than the median time past of its parent, even
+	// if the local clock says otherwise.
+	timestamp := AdjustedTime()
+	if mtp := chain.MedianTimePast(lastHash); timestamp <= mtp {
+		timestamp = mtp + 1
+	}
+
+	newBlock := CreateBlock(transactions, lastHash, lastHeight+1, timestamp)
 
 	err = chain.Database.Update(func(txn *badger.Txn) error {
 		err := txn.Set(newBlock.Hash, newBlock.Serialize())
@@ -333,22 +395,65 @@ func (iterator *BlockChainIterator) Next() *Block {
 }
 
 func (chain *BlockChain) FindTransactions(ID []byte) (Transaction, error) {
-	iterator := chain.Iterator()
+	tx, _, err := chain.findTransaction(chain.LastHash, ID)
+	return tx, err
+}
+
+// TransactionFee returns what the inputs of tx hold beyond its outputs
+func (chain *BlockChain) TransactionFee(tx *Transaction) (Amount, error) {
+	return chain.TransactionFeeWith(tx, nil)
+}
+
+// TransactionFeeWith is TransactionFee for a transaction that may spend
+// outputs of the unconfirmed transactions, keyed by hex ID.
+func (chain *BlockChain) TransactionFeeWith(tx *Transaction, unconfirmed map[string]*Transaction) (Amount, error) {
+	var values []Amount
+	for _, in := range tx.Inputs {
+		prevTX, err := chain.FindTransactions(in.ID)
+		if parent, ok := unconfirmed[hex.EncodeToString(in.ID)]; err != nil && ok {
+			prevTX, err = *parent, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+			return 0, fmt.Errorf("input spends missing output %x:%d", in.ID, in.Out)
+		}
+		values = append(values, prevTX.Outputs[in.Out].Value)
+	}
+
+	inputValue, err := SumAmounts(values...)
+	if err != nil {
+		return 0, err
+	}
+	outputValue, err := tx.OutputValue()
+	if err != nil {
+		return 0, err
+	}
+	return inputValue - outputValue, nil
+}
+
+var errTxNotFound = errors.New("Transaction not found")
+
+// findTransaction walks back from the block with hash tip and returns the
+// transaction along with the height of the block holding it.
+func (chain *BlockChain) findTransaction(tip, ID []byte) (Transaction, int, error) {
+	iterator := BlockChainIterator{tip, chain.Database}
 	for {
 		block := iterator.Next()
 		for _, tx := range block.Transactions {
 			if bytes.Equal(tx.ID, ID) {
-				return *tx, nil
+				return *tx, block.Height, nil
 			}
 		}
 		if len(block.PrevHash) == 0 {
 			break
 		}
 	}
-	return Transaction{}, errors.New("Transaction not found")
+	return Transaction{}, 0, errTxNotFound
 }
 
-func (chain *BlockChain) SignTransaction(tx *Transaction, privateKey ecdsa.PrivateKey) {
+func (chain *BlockChain) SignTransaction(tx *Transaction, w *wallet.Wallet) {
 	prevTXs := make(map[string]Transaction)
 
 	for _, in := range tx.Inputs {
@@ -356,13 +461,16 @@ func (chain *BlockChain) SignTransaction(tx *Transaction, privateKey ecdsa.Priva
 		Handle(err)
 		prevTXs[hex.EncodeToString(prevTx.ID)] = prevTx
 	}
-	tx.Sign(privateKey, prevTXs)
+	tx.Sign(w, prevTXs)
 }
 
 func (chain *BlockChain) VerifyTransaction(tx *Transaction) bool {
 	if tx.IsCoinbase() {
 		return true
 	}
+	if err := tx.Check(); err != nil {
+		return false
+	}
 
 	prevTXs := make(map[string]Transaction)
 
@@ -0,0 +1,306 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Sizes used to estimate the fee of a transaction before it is built. They
+// are upper bounds of the gob encoding, whose type description makes up
+// most of the overhead.
+const (
+	txOverheadSize = 300
+	inputSize      = 142
+	outputSize     = 32
+)
+
+// FeeRate is a fee in base units per byte of serialized transaction.
+type FeeRate int64
+
+// DefaultFeeRate is paid by wallet transactions unless told otherwise.
+var DefaultFeeRate FeeRate = 10
+
+func (r FeeRate) Fee(size int) Amount {
+	return Amount(r) * Amount(size)
+}
+
+// DustThreshold is the value below which an output costs more than a third
+// of itself to create and spend later.
+func (r FeeRate) DustThreshold() Amount {
+	return 3 * r.Fee(inputSize+outputSize)
+}
+
+// outputsSize estimates the bytes a set of outputs adds to a transaction.
+func outputsSize(outputs []TxOutput) int {
+	size := 0
+	for _, out := range outputs {
+		size += outputSize + len(out.Data)
+	}
+	return size
+}
+
+// SpendableOutput is an unspent output a wallet can spend.
+type SpendableOutput struct {
+	TxID  []byte
+	Out   int
+	Value Amount
+}
+
+// SelectionTarget is what the selected coins have to pay for.
+type SelectionTarget struct {
+	// Amount is the total of the payment outputs, OutputSize the bytes
+	// they take.
+	Amount     Amount
+	OutputSize int
+	FeeRate    FeeRate
+}
+
+// effectiveValue is what a coin adds once the fee of spending it is paid.
+func (t SelectionTarget) effectiveValue(c SpendableOutput) Amount {
+	return c.Value - t.FeeRate.Fee(inputSize)
+}
+
+// needed is the effective value the inputs must reach to pay the outputs
+// and the fee of everything but the inputs and a change output.
+func (t SelectionTarget) needed() Amount {
+	return t.Amount + t.FeeRate.Fee(txOverheadSize+t.OutputSize)
+}
+
+// changeThreshold is the leftover a change output needs to be worth more
+// than dust once its own fee is paid. Smaller leftovers go to the miner.
+func (t SelectionTarget) changeThreshold() Amount {
+	return t.FeeRate.Fee(outputSize) + t.FeeRate.DustThreshold()
+}
+
+// CoinSelector picks the coins that fund a payment. It returns nil when it
+// finds no set of coins that covers the target.
+type CoinSelector interface {
+	Select(coins []SpendableOutput, target SelectionTarget) []SpendableOutput
+}
+
+// Selection is the outcome of coin selection.
+type Selection struct {
+	Coins []SpendableOutput
+	Fee   Amount
+
+	// Change is zero when the transaction gets no change output.
+	Change Amount
+}
+
+var ErrInsufficientFunds = errors.New("not enough funds")
+
+// SelectCoins runs a selector and works out the fee and the change. Coins
+// that cost more to spend than they are worth are never offered to it, and
+// change below the dust threshold is left to the fee.
+func SelectCoins(selector CoinSelector, coins []SpendableOutput, target SelectionTarget) (*Selection, error) {
+	var usable []SpendableOutput
+	for _, c := range coins {
+		if target.effectiveValue(c) > 0 {
+			usable = append(usable, c)
+		}
+	}
+
+	selected := selector.Select(usable, target)
+	if selected == nil {
+		return nil, ErrInsufficientFunds
+	}
+
+	var total, effective Amount
+	for _, c := range selected {
+		total += c.Value
+		effective += target.effectiveValue(c)
+	}
+	if effective < target.needed() {
+		return nil, ErrInsufficientFunds
+	}
+
+	selection := &Selection{Coins: selected, Fee: total - target.Amount}
+	if excess := effective - target.needed(); excess > target.changeThreshold() {
+		selection.Change = excess - target.FeeRate.Fee(outputSize)
+		selection.Fee -= selection.Change
+	}
+	return selection, nil
+}
+
+// accumulate takes coins in order until their effective value is enough.
+func accumulate(coins []SpendableOutput, target SelectionTarget) []SpendableOutput {
+	var selected []SpendableOutput
+	var effective Amount
+	for _, c := range coins {
+		selected = append(selected, c)
+		effective += target.effectiveValue(c)
+		if effective >= target.needed() {
+			return selected
+		}
+	}
+	return nil
+}
+
+func sortedCoins(coins []SpendableOutput, descending bool) []SpendableOutput {
+	sorted := append([]SpendableOutput{}, coins...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if descending {
+			return sorted[i].Value > sorted[j].Value
+		}
+		return sorted[i].Value < sorted[j].Value
+	})
+	return sorted
+}
+
+// LargestFirst spends the biggest coins first, which keeps the number of
+// inputs and so the fee low.
+type LargestFirst struct{}
+
+func (LargestFirst) Select(coins []SpendableOutput, target SelectionTarget) []SpendableOutput {
+	return accumulate(sortedCoins(coins, true), target)
+}
+
+// SmallestFirst spends the smallest coins first, consolidating them at the
+// price of a larger fee.
+type SmallestFirst struct{}
+
+func (SmallestFirst) Select(coins []SpendableOutput, target SelectionTarget) []SpendableOutput {
+	return accumulate(sortedCoins(coins, false), target)
+}
+
+// bnbMaxTries bounds the depth-first search of BranchAndBound.
+const bnbMaxTries = 100000
+
+// BranchAndBound searches for a set of coins that pays the target so
+// exactly that no change output is needed, preferring the set that wastes
+// the least. When there is none it falls back to Fallback, or to
+// LargestFirst if that is not set.
+type BranchAndBound struct {
+	Fallback CoinSelector
+}
+
+func (s BranchAndBound) Select(coins []SpendableOutput, target SelectionTarget) []SpendableOutput {
+	if selected := branchAndBound(sortedCoins(coins, true), target); selected != nil {
+		return selected
+	}
+	if s.Fallback != nil {
+		return s.Fallback.Select(coins, target)
+	}
+	return LargestFirst{}.Select(coins, target)
+}
+
+func branchAndBound(coins []SpendableOutput, target SelectionTarget) []SpendableOutput {
+	low := target.needed()
+	high := low + target.changeThreshold()
+
+	values := make([]Amount, len(coins))
+	var remaining Amount
+	for i, c := range coins {
+		values[i] = target.effectiveValue(c)
+		remaining += values[i]
+	}
+	if remaining < low {
+		return nil
+	}
+
+	var best []bool
+	var bestWaste Amount
+	picked := make([]bool, len(coins))
+	tries := 0
+
+	var search func(depth int, sum, remaining Amount)
+	search = func(depth int, sum, remaining Amount) {
+		tries++
+		if tries > bnbMaxTries || sum > high || sum+remaining < low {
+			return
+		}
+		if sum >= low {
+			if waste := sum - low; best == nil || waste < bestWaste {
+				best = append([]bool{}, picked...)
+				bestWaste = waste
+			}
+			return
+		}
+		if depth == len(coins) {
+			return
+		}
+
+		remaining -= values[depth]
+		// Taking a coin of the same value as the one just left out only
+		// repeats the search.
+		if depth == 0 || picked[depth-1] || values[depth] != values[depth-1] {
+			picked[depth] = true
+			search(depth+1, sum+values[depth], remaining)
+			picked[depth] = false
+		}
+		search(depth+1, sum, remaining)
+	}
+	search(0, 0, remaining)
+
+	if best == nil {
+		return nil
+	}
+	var selected []SpendableOutput
+	for i, ok := range best {
+		if ok {
+			selected = append(selected, coins[i])
+		}
+	}
+	return selected
+}
+
+// RandomImprove picks coins at random until the target is covered, then
+// keeps adding random coins while that brings the change closer to the
+// payment amount, without going past twice it. Change of a similar size to
+// the payment makes it harder to tell which output is which.
+type RandomImprove struct{}
+
+func (RandomImprove) Select(coins []SpendableOutput, target SelectionTarget) []SpendableOutput {
+	shuffled := append([]SpendableOutput{}, coins...)
+	rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	selected := accumulate(shuffled, target)
+	if selected == nil {
+		return nil
+	}
+
+	var effective Amount
+	for _, c := range selected {
+		effective += target.effectiveValue(c)
+	}
+
+	ideal := target.needed() + target.Amount
+	limit := target.needed() + 2*target.Amount
+	for _, c := range shuffled[len(selected):] {
+		next := effective + target.effectiveValue(c)
+		if next > limit || distance(next, ideal) >= distance(effective, ideal) {
+			continue
+		}
+		selected = append(selected, c)
+		effective = next
+	}
+	return selected
+}
+
+func distance(a, b Amount) Amount {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// DefaultCoinSelector is used when a payment names no strategy.
+var DefaultCoinSelector CoinSelector = BranchAndBound{}
+
+// ParseCoinSelector returns the strategy with the given name.
+func ParseCoinSelector(name string) (CoinSelector, error) {
+	switch strings.ToLower(name) {
+	case "largest", "largest-first":
+		return LargestFirst{}, nil
+	case "smallest", "smallest-first":
+		return SmallestFirst{}, nil
+	case "bnb", "branch-and-bound":
+		return BranchAndBound{}, nil
+	case "random", "random-improve":
+		return RandomImprove{}, nil
+	}
+	return nil, fmt.Errorf("unknown coin selection strategy %q", name)
+}
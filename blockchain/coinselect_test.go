@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// The cases pay 1000 at a fee rate of 1, which needs an effective value of
+// 1332 for the overhead and the payment output. Each input costs 142, and
+// a leftover of more than 554 gets a change output costing 32.
+func TestSelectCoins(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector CoinSelector
+		coins    []Amount
+
+		want       []Amount
+		wantChange Amount
+		wantFee    Amount
+		wantErr    error
+	}{
+		{"bnb exact coin", BranchAndBound{}, []Amount{5000, 1474, 700, 800}, []Amount{1474}, 0, 474, nil},
+		{"bnb exact pair", BranchAndBound{}, []Amount{10000, 742, 874}, []Amount{742, 874}, 0, 616, nil},
+		{"bnb falls back to largest first", BranchAndBound{}, []Amount{10000, 20000}, []Amount{20000}, 18494, 506, nil},
+		{"bnb falls back to its fallback", BranchAndBound{SmallestFirst{}}, []Amount{10000, 20000}, []Amount{10000}, 8494, 506, nil},
+		{"bnb leaves dust to the fee", BranchAndBound{}, []Amount{2028}, []Amount{2028}, 0, 1028, nil},
+		{"bnb change above the dust threshold", BranchAndBound{}, []Amount{2029}, []Amount{2029}, 523, 506, nil},
+		{"bnb insufficient funds", BranchAndBound{}, []Amount{1200, 100}, nil, 0, 0, ErrInsufficientFunds},
+
+		{"random exact coin", RandomImprove{}, []Amount{1474}, []Amount{1474}, 0, 474, nil},
+		{"random leaves dust to the fee", RandomImprove{}, []Amount{2028}, []Amount{2028}, 0, 1028, nil},
+		{"random change above the dust threshold", RandomImprove{}, []Amount{2029}, []Amount{2029}, 523, 506, nil},
+		{"random stops short of twice the amount", RandomImprove{}, []Amount{1142, 1142, 1142, 1142, 1142}, []Amount{1142, 1142}, 636, 648, nil},
+		{"random insufficient funds", RandomImprove{}, []Amount{1200, 100}, nil, 0, 0, ErrInsufficientFunds},
+	}
+
+	target := SelectionTarget{1000, outputSize, 1}
+	for _, test := range tests {
+		var coins []SpendableOutput
+		for i, value := range test.coins {
+			coins = append(coins, SpendableOutput{[]byte{byte(i)}, i, value})
+		}
+
+		selection, err := SelectCoins(test.selector, coins, target)
+		if err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		var got []Amount
+		for _, c := range selection.Coins {
+			got = append(got, c.Value)
+		}
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: selected %v, want %v", test.name, got, test.want)
+		}
+		if selection.Change != test.wantChange || selection.Fee != test.wantFee {
+			t.Errorf("%s: change %d and fee %d, want %d and %d", test.name, selection.Change, selection.Fee, test.wantChange, test.wantFee)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/TualatinX/blockchain-go/wallet"
+)
+
+// A signed transaction can come out a few bytes longer than the one its fee
+// was worked out for, so bumps are signed again until the size settles.
+const maxBumpAttempts = 3
+
+func (b *TxBuilder) unconfirmed() map[string]*Transaction {
+	if b.Pending == nil {
+		return nil
+	}
+	return b.Pending.Unconfirmed()
+}
+
+// feeRateOf returns the fee a transaction pays, which may spend outputs of
+// the wallet's pending transactions, and its fee rate.
+func (b *TxBuilder) feeRateOf(tx *Transaction) (Amount, FeeRate, error) {
+	fee, err := b.UTXO.Blockchain.TransactionFeeWith(tx, b.unconfirmed())
+	if err != nil {
+		return 0, 0, err
+	}
+	return fee, FeeRate(fee / Amount(len(tx.Serialize()))), nil
+}
+
+// descendantsFee adds up the fees of the wallet's pending transactions that
+// spend outputs of tx, or of those spending them, which a replacement of tx
+// replaces as well.
+func (b *TxBuilder) descendantsFee(tx *Transaction) (Amount, error) {
+	unconfirmed := b.unconfirmed()
+	replaced := map[string]bool{hex.EncodeToString(tx.ID): true}
+
+	var fees []Amount
+	for changed := true; changed; {
+		changed = false
+		for id, child := range unconfirmed {
+			if replaced[id] {
+				continue
+			}
+			for _, in := range child.Inputs {
+				if replaced[hex.EncodeToString(in.ID)] {
+					fee, err := b.UTXO.Blockchain.TransactionFeeWith(child, unconfirmed)
+					if err != nil {
+						return 0, err
+					}
+					fees = append(fees, fee)
+					replaced[id] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return SumAmounts(fees...)
+}
+
+// BumpFee builds a replacement of tx, an unconfirmed transaction of the
+// wallet that signals replace-by-fee, paying rate. It spends the same
+// inputs and pays the same outputs, taking the extra fee out of the change
+// to ChangeAddress, which is dropped if too little of it would be left.
+// Nodes only take a replacement paying more than every transaction it
+// replaces, so the fee is raised above what tx and its pending descendants
+// pay together if rate falls short of that.
+func (b *TxBuilder) BumpFee(tx *Transaction, rate FeeRate) (*Transaction, error) {
+	if b.Wallet == nil {
+		return nil, errors.New("transaction builder has no wallet to sign with")
+	}
+	if !tx.IsReplaceable() {
+		return nil, fmt.Errorf("transaction %x does not signal replace-by-fee", tx.ID)
+	}
+	oldFee, oldRate, err := b.feeRateOf(tx)
+	if err != nil {
+		return nil, err
+	}
+	if rate <= oldRate {
+		return nil, fmt.Errorf("fee rate must be above the %d per byte paid now", oldRate)
+	}
+	descendantsFee, err := b.descendantsFee(tx)
+	if err != nil {
+		return nil, err
+	}
+	replacedFee, err := SumAmounts(oldFee, descendantsFee)
+	if err != nil {
+		return nil, err
+	}
+
+	change := -1
+	if changeHash, err := wallet.PubKeyHashOf(b.ChangeAddress); err == nil {
+		for outId, out := range tx.Outputs {
+			if out.IsLockedWithKey(changeHash) {
+				change = outId
+			}
+		}
+	}
+	if change < 0 {
+		return nil, errors.New("transaction has no change output to pay the higher fee from")
+	}
+
+	size := len(tx.Serialize())
+	for attempt := 0; attempt < maxBumpAttempts; attempt++ {
+		replacement := tx.TrimmedCopy()
+
+		fee := rate.Fee(size)
+		if fee <= replacedFee {
+			fee = replacedFee + 1
+		}
+		extra := fee - oldFee
+		left := tx.Outputs[change].Value - extra
+		if left < 0 || (left < rate.DustThreshold() && len(tx.Outputs) == 1) {
+			return nil, fmt.Errorf("change of %s can not pay %s more in fees", tx.Outputs[change].Value, extra)
+		}
+		if left < rate.DustThreshold() {
+			replacement.Outputs = append(replacement.Outputs[:change:change], replacement.Outputs[change+1:]...)
+		} else {
+			replacement.Outputs[change].Value = left
+		}
+
+		if err := b.sign(&replacement); err != nil {
+			return nil, err
+		}
+		if signed := len(replacement.Serialize()); signed > size {
+			size = signed
+			continue
+		}
+		return &replacement, nil
+	}
+	return nil, errors.New("could not settle the size of the replacement")
+}
+
+// ChildPaysForParent builds a transaction spending an output parent pays to
+// the wallet, back to ChangeAddress, with a fee high enough for the two of
+// them together to pay rate. Miners picking transactions by the fee rate of
+// their unconfirmed ancestors will then include the parent along with it.
+func (b *TxBuilder) ChildPaysForParent(parent *Transaction, rate FeeRate) (*Transaction, error) {
+	if b.Wallet == nil {
+		return nil, errors.New("transaction builder has no wallet to sign with")
+	}
+	pubKeyHash := b.pubKeyHash()
+
+	out := -1
+	for outId, output := range parent.Outputs {
+		if output.IsLockedWithKey(pubKeyHash) && !(b.Pending != nil && b.Pending.IsLocked(parent.ID, outId)) {
+			out = outId
+			break
+		}
+	}
+	if out < 0 {
+		return nil, fmt.Errorf("transaction %x pays nothing the wallet can spend", parent.ID)
+	}
+	value := parent.Outputs[out].Value
+
+	parentFee, parentRate, err := b.feeRateOf(parent)
+	if err != nil {
+		return nil, err
+	}
+	if rate <= parentRate {
+		return nil, fmt.Errorf("fee rate must be above the %d per byte paid now", parentRate)
+	}
+	parentSize := len(parent.Serialize())
+
+	sequence := SequenceFinal
+	if b.Replaceable {
+		sequence = SequenceReplaceable
+	}
+	destination := TxOutput{value, pubKeyHash, nil}
+	if b.ChangeAddress != "" {
+		destination = *NewTXOutput(value, b.ChangeAddress)
+	}
+
+	child := Transaction{nil, []TxInput{{parent.ID, out, nil, nil, sequence}}, []TxOutput{destination}}
+	size := outputSize + inputSize + txOverheadSize
+	for attempt := 0; attempt < maxBumpAttempts; attempt++ {
+		fee := rate.Fee(parentSize+size) - parentFee
+		if fee < rate.Fee(size) {
+			fee = rate.Fee(size)
+		}
+		if value-fee < rate.DustThreshold() {
+			return nil, fmt.Errorf("output of %s is too small to pay a fee of %s", value, fee)
+		}
+		child.Outputs[0].Value = value - fee
+
+		if err := b.sign(&child); err != nil {
+			return nil, err
+		}
+		if signed := len(child.Serialize()); signed > size {
+			size = signed
+			continue
+		}
+		return &child, nil
+	}
+	return nil, errors.New("could not settle the size of the child transaction")
+}
@@ -0,0 +1,276 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+const feeEstimatesFile = "./tmp/fees_%s.data"
+
+const (
+	// MaxConfirmTarget is the most blocks a fee estimate can aim for.
+	// Transactions waiting longer count as not confirmed in time.
+	MaxConfirmTarget = 25
+
+	// DefaultConfirmTarget is what wallet payments aim for.
+	DefaultConfirmTarget = 6
+
+	// Fee rate buckets grow by feeBucketSpacing from 1 up to
+	// maxBucketFeeRate units per byte.
+	feeBucketSpacing = 1.25
+	maxBucketFeeRate = 1e6
+
+	// Older observations are weighted down by feeDecay every block.
+	feeDecay = 0.998
+
+	// An estimate needs feeSuccessRate of the transactions in its buckets
+	// to confirm in time, and feeMinSamples of them to say so.
+	feeSuccessRate = 0.85
+	feeMinSamples  = 2
+
+	// recentFeeBlocks is how far back the fee rates of recent blocks are
+	// looked at when there are not enough observations.
+	recentFeeBlocks = 20
+)
+
+// MinFeeRate is the lowest fee rate an estimate returns.
+var MinFeeRate FeeRate = 1
+
+var feeBuckets = func() []float64 {
+	var buckets []float64
+	for rate := 1.0; rate <= maxBucketFeeRate; rate *= feeBucketSpacing {
+		buckets = append(buckets, rate)
+	}
+	return buckets
+}()
+
+func feeBucket(rate FeeRate) int {
+	i := sort.SearchFloat64s(feeBuckets, float64(rate)+0.5)
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+type trackedTx struct {
+	Height int
+	Bucket int
+}
+
+// FeeEstimator learns how many blocks transactions of each fee rate wait in
+// the mempool before they confirm.
+type FeeEstimator struct {
+	mu sync.Mutex
+
+	// Confirmed[b][t] is the decayed number of transactions of bucket b
+	// that confirmed within t+1 blocks. Total[b] also counts the ones that
+	// took longer than MaxConfirmTarget blocks.
+	Confirmed [][]float64
+	Total     []float64
+
+	// Tracked holds the mempool transactions not confirmed yet.
+	Tracked map[string]trackedTx
+}
+
+func NewFeeEstimator() *FeeEstimator {
+	e := &FeeEstimator{
+		Confirmed: make([][]float64, len(feeBuckets)),
+		Total:     make([]float64, len(feeBuckets)),
+		Tracked:   make(map[string]trackedTx),
+	}
+	for b := range e.Confirmed {
+		e.Confirmed[b] = make([]float64, MaxConfirmTarget)
+	}
+	return e
+}
+
+// LoadFeeEstimator reads the estimates kept by the node, or starts empty.
+func LoadFeeEstimator(nodeId string) *FeeEstimator {
+	data, err := ioutil.ReadFile(fmt.Sprintf(feeEstimatesFile, nodeId))
+	if err != nil {
+		return NewFeeEstimator()
+	}
+
+	e := NewFeeEstimator()
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(e); err != nil || len(e.Total) != len(feeBuckets) {
+		return NewFeeEstimator()
+	}
+	if e.Tracked == nil {
+		e.Tracked = make(map[string]trackedTx)
+	}
+	return e
+}
+
+func (e *FeeEstimator) SaveFile(nodeId string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var content bytes.Buffer
+	if err := gob.NewEncoder(&content).Encode(e); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fmt.Sprintf(feeEstimatesFile, nodeId), content.Bytes(), 0644)
+}
+
+// TransactionFeeRate returns the fee rate a transaction pays.
+func (chain *BlockChain) TransactionFeeRate(tx *Transaction) (FeeRate, error) {
+	fee, err := chain.TransactionFee(tx)
+	if err != nil {
+		return 0, err
+	}
+	return FeeRate(fee / Amount(len(tx.Serialize()))), nil
+}
+
+// ProcessTransaction starts tracking a transaction that entered the mempool
+// while the best block was at height.
+func (e *FeeEstimator) ProcessTransaction(tx *Transaction, rate FeeRate, height int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id := hex.EncodeToString(tx.ID)
+	if _, ok := e.Tracked[id]; !ok {
+		e.Tracked[id] = trackedTx{height, feeBucket(rate)}
+	}
+}
+
+// RemoveTransaction stops tracking a transaction that left the mempool
+// without being confirmed.
+func (e *FeeEstimator) RemoveTransaction(id []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.Tracked, hex.EncodeToString(id))
+}
+
+// ProcessBlock records how long the tracked transactions in block waited.
+func (e *FeeEstimator) ProcessBlock(block *Block) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for b := range e.Total {
+		e.Total[b] *= feeDecay
+		for t := range e.Confirmed[b] {
+			e.Confirmed[b][t] *= feeDecay
+		}
+	}
+
+	for _, tx := range block.Transactions {
+		id := hex.EncodeToString(tx.ID)
+		tracked, ok := e.Tracked[id]
+		if !ok {
+			continue
+		}
+		delete(e.Tracked, id)
+
+		waited := block.Height - tracked.Height
+		if waited < 1 {
+			waited = 1
+		}
+		e.Total[tracked.Bucket]++
+		for t := waited - 1; t < MaxConfirmTarget; t++ {
+			e.Confirmed[tracked.Bucket][t]++
+		}
+	}
+
+	// Transactions that waited too long count as failures of their bucket.
+	for id, tracked := range e.Tracked {
+		if block.Height-tracked.Height > MaxConfirmTarget {
+			e.Total[tracked.Bucket]++
+			delete(e.Tracked, id)
+		}
+	}
+}
+
+// Estimate returns the lowest fee rate at which transactions have been
+// confirmed within target blocks often enough. It reports false when it
+// has not seen enough transactions to tell.
+func (e *FeeEstimator) Estimate(target int) (FeeRate, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if target < 1 {
+		target = 1
+	}
+	if target > MaxConfirmTarget {
+		target = MaxConfirmTarget
+	}
+
+	// Buckets are grouped from the highest fee rate down until a group has
+	// enough samples, and the search stops at the first group that fails.
+	best := -1
+	var confirmed, total float64
+	for b := len(feeBuckets) - 1; b >= 0; b-- {
+		confirmed += e.Confirmed[b][target-1]
+		total += e.Total[b]
+		if total < feeMinSamples {
+			continue
+		}
+		if confirmed/total < feeSuccessRate {
+			break
+		}
+		best = b
+		confirmed, total = 0, 0
+	}
+
+	if best < 0 {
+		return 0, false
+	}
+	return FeeRate(math.Ceil(feeBuckets[best])), true
+}
+
+// RecentFeeRate returns the median fee rate paid by the transactions in the
+// last blocks of the chain, or false if they hold none.
+func (chain *BlockChain) RecentFeeRate() (FeeRate, bool) {
+	var rates []FeeRate
+
+	iter := chain.Iterator()
+	for i := 0; i < recentFeeBlocks; i++ {
+		block := iter.Next()
+		for _, tx := range block.Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			if rate, err := chain.TransactionFeeRate(tx); err == nil {
+				rates = append(rates, rate)
+			}
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	if len(rates) == 0 {
+		return 0, false
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+	return rates[len(rates)/2], true
+}
+
+// EstimateFee returns the fee rate to pay to be confirmed within target
+// blocks. It uses what the node learned from its mempool, then the fee
+// rates of recent blocks, and DefaultFeeRate when there is neither.
+func (chain *BlockChain) EstimateFee(nodeId string, target int) FeeRate {
+	rate, ok := LoadFeeEstimator(nodeId).Estimate(target)
+	if !ok {
+		rate, ok = chain.RecentFeeRate()
+	}
+	if !ok {
+		rate = DefaultFeeRate
+	}
+	if rate < MinFeeRate {
+		rate = MinFeeRate
+	}
+	return rate
+}
+
+// removeFeeEstimates is used when the chain is created from scratch.
+func removeFeeEstimates(nodeId string) {
+	os.Remove(fmt.Sprintf(feeEstimatesFile, nodeId))
+}
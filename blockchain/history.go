@@ -0,0 +1,143 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/TualatinX/blockchain-go/wallet"
+)
+
+// SyncWalletHistory scans the blocks connected since the last scan of the
+// wallet history, and the wallet's unconfirmed transactions, keyed by hex
+// ID. The history is rebuilt from the first block when the block scanned
+// last is no longer in the chain.
+func (chain *BlockChain) SyncWalletHistory(ws *wallet.Wallets, unconfirmed map[string]*Transaction) {
+	owned := ws.OwnPubKeyHashes()
+	scanned := ws.ScannedHash()
+
+	var blocks []*Block
+	found := false
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+		if scanned != nil && bytes.Equal(block.Hash, scanned) {
+			found = true
+			break
+		}
+		blocks = append(blocks, block)
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	if !found {
+		ws.ResetHistory()
+	}
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block := blocks[i]
+		for _, tx := range block.Transactions {
+			if entry := chain.walletTx(tx, owned, nil); entry != nil {
+				entry.Height = block.Height
+				entry.Time = block.Timestamp
+				ws.RecordTx(entry)
+			}
+		}
+	}
+
+	for _, tx := range unconfirmed {
+		if entry := chain.walletTx(tx, owned, unconfirmed); entry != nil {
+			entry.Time = time.Now().Unix()
+			ws.RecordTx(entry)
+		}
+	}
+
+	ws.FinishScan(chain.LastHash, func(txID []byte) bool {
+		_, ok := unconfirmed[hex.EncodeToString(txID)]
+		return ok
+	})
+}
+
+// walletTx tells what tx did to the wallet whose addresses are owned, by
+// public key hash. It returns nil for transactions that do not touch it.
+func (chain *BlockChain) walletTx(tx *Transaction, owned map[string]string, unconfirmed map[string]*Transaction) *wallet.WalletTx {
+	var spent, received, paid Amount
+	var receiver string
+	payees := make(map[string][]byte)
+	addresses := make(map[string]bool)
+
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Inputs {
+			address, ok := owned[hex.EncodeToString(wallet.PublicKeyHash(in.PubKey))]
+			if !ok {
+				continue
+			}
+			prevTx, err := chain.FindTransactions(in.ID)
+			if parent, ok := unconfirmed[hex.EncodeToString(in.ID)]; err != nil && ok {
+				prevTx, err = *parent, nil
+			}
+			if err != nil || in.Out < 0 || in.Out >= len(prevTx.Outputs) {
+				continue
+			}
+			spent += prevTx.Outputs[in.Out].Value
+			addresses[address] = true
+		}
+	}
+
+	for _, out := range tx.Outputs {
+		if out.IsData() {
+			continue
+		}
+		if address, ok := owned[hex.EncodeToString(out.PubKeyHash)]; ok {
+			if receiver == "" {
+				receiver = address
+			}
+			received += out.Value
+			addresses[address] = true
+			continue
+		}
+		payees[hex.EncodeToString(out.PubKeyHash)] = out.PubKeyHash
+		paid += out.Value
+	}
+
+	if spent == 0 && received == 0 {
+		return nil
+	}
+
+	entry := &wallet.WalletTx{TxID: tx.ID, Height: -1}
+	for address := range addresses {
+		entry.Addresses = append(entry.Addresses, address)
+	}
+	sort.Strings(entry.Addresses)
+
+	switch {
+	case tx.IsCoinbase():
+		entry.Direction = wallet.Generated
+		entry.Address = receiver
+		entry.Amount = int64(received)
+	case spent == 0:
+		entry.Direction = wallet.Received
+		entry.Address = receiver
+		entry.Amount = int64(received)
+	case paid > 0:
+		entry.Direction = wallet.Sent
+		entry.Recipients = len(payees)
+		entry.Amount = int64(paid)
+		if len(payees) == 1 {
+			for _, payee := range payees {
+				entry.PubKeyHash = payee
+			}
+		}
+	default:
+		entry.Direction = wallet.Self
+		entry.Address = receiver
+	}
+
+	if spent > 0 {
+		if fee, err := chain.TransactionFeeWith(tx, unconfirmed); err == nil {
+			entry.Fee = int64(fee)
+		}
+	}
+	return entry
+}
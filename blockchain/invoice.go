@@ -0,0 +1,278 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/TualatinX/blockchain-go/wallet"
+)
+
+const invoicesFile = "./tmp/invoices_%s.data"
+
+// DefaultInvoiceConfirmations is how deep the payment of an invoice must be
+// buried before it counts as confirmed, unless the invoice says otherwise.
+const DefaultInvoiceConfirmations = 3
+
+type InvoiceStatus string
+
+const (
+	InvoiceUnpaid    InvoiceStatus = "unpaid"
+	InvoiceUnderpaid InvoiceStatus = "underpaid"
+	InvoicePaid      InvoiceStatus = "paid"
+	InvoiceOverpaid  InvoiceStatus = "overpaid"
+	InvoiceExpired   InvoiceStatus = "expired"
+)
+
+// Invoice asks for Amount to be paid to a fresh address of the wallet
+// before it expires.
+type Invoice struct {
+	ID      int
+	Address string
+	Amount  Amount
+	Memo    string
+
+	// Created and Expires are unix times. Payments in blocks stamped after
+	// Expires do not count.
+	Created int64
+	Expires int64
+
+	// Height is the best height when the invoice was created. Payments are
+	// looked for in the blocks above it.
+	Height int
+
+	// Confirmations is how many are needed for the payment to be confirmed.
+	Confirmations int
+
+	// The fields below are worked out from the chain by Update.
+	Status   InvoiceStatus
+	Received Amount
+
+	// PaidHeight is the height of the block holding the last payment, -1
+	// while there is none.
+	PaidHeight int
+	Payments   [][]byte
+
+	// Settled is set once nothing can change the invoice anymore, after
+	// which Update leaves it alone.
+	Settled bool
+}
+
+// isSettled tells whether the invoice is done with: it was paid in full
+// and the payment has its confirmations, or it expired before any block
+// that can still be added, with any payment it got confirmed. Payments to
+// a settled invoice are not looked for anymore.
+func (inv *Invoice) isSettled(bestHeight int, medianTimePast int64) bool {
+	switch {
+	case inv.PaidHeight >= 0 && inv.State(bestHeight) != "confirmed":
+		return false
+	case inv.Status == InvoicePaid || inv.Status == InvoiceOverpaid:
+		return true
+	default:
+		// Blocks to come are stamped after the median time past.
+		return medianTimePast >= inv.Expires
+	}
+}
+
+// ConfirmationsAt counts the confirmations of the payment when the best
+// block is at bestHeight.
+func (inv *Invoice) ConfirmationsAt(bestHeight int) int {
+	if inv.PaidHeight < 0 {
+		return 0
+	}
+	return bestHeight - inv.PaidHeight + 1
+}
+
+// State is "pending" until the payment has the confirmations the invoice
+// asks for and "confirmed" from then on. It is empty while nothing was
+// paid.
+func (inv *Invoice) State(bestHeight int) string {
+	switch {
+	case inv.PaidHeight < 0:
+		return ""
+	case inv.ConfirmationsAt(bestHeight) < inv.Confirmations:
+		return "pending"
+	default:
+		return "confirmed"
+	}
+}
+
+// Describe tells the status of the invoice along with how far its payment
+// is from being confirmed, such as "paid (pending, 1 of 3 confirmations)".
+func (inv *Invoice) Describe(bestHeight int) string {
+	switch inv.State(bestHeight) {
+	case "pending":
+		return fmt.Sprintf("%s (pending, %d of %d confirmations)", inv.Status, inv.ConfirmationsAt(bestHeight), inv.Confirmations)
+	case "confirmed":
+		return fmt.Sprintf("%s (confirmed)", inv.Status)
+	}
+	return string(inv.Status)
+}
+
+// URI is the payment request to hand to the payer.
+func (inv *Invoice) URI() string {
+	request := PaymentURI{Address: inv.Address, Amount: inv.Amount, Message: inv.Memo}
+	return request.String()
+}
+
+// Invoices is the invoice store of a node.
+type Invoices struct {
+	LastID   int
+	Invoices map[int]*Invoice
+}
+
+func LoadInvoices(nodeId string) *Invoices {
+	invs := &Invoices{0, make(map[int]*Invoice)}
+
+	data, err := ioutil.ReadFile(fmt.Sprintf(invoicesFile, nodeId))
+	if err != nil {
+		return invs
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(invs); err != nil || invs.Invoices == nil {
+		return &Invoices{0, make(map[int]*Invoice)}
+	}
+	return invs
+}
+
+func (invs *Invoices) SaveFile(nodeId string) {
+	var content bytes.Buffer
+
+	err := gob.NewEncoder(&content).Encode(invs)
+	Handle(err)
+
+	err = ioutil.WriteFile(fmt.Sprintf(invoicesFile, nodeId), content.Bytes(), 0644)
+	Handle(err)
+}
+
+// Add stores a new invoice for amount to address, made at now with the
+// best block at height, and returns it with its ID set.
+func (invs *Invoices) Add(address string, amount Amount, memo string, now, expires int64, height, confirmations int) *Invoice {
+	invs.LastID++
+	inv := &Invoice{
+		ID:            invs.LastID,
+		Address:       address,
+		Amount:        amount,
+		Memo:          memo,
+		Created:       now,
+		Expires:       expires,
+		Height:        height,
+		Confirmations: confirmations,
+		Status:        InvoiceUnpaid,
+		PaidHeight:    -1,
+	}
+	invs.Invoices[inv.ID] = inv
+	return inv
+}
+
+// List returns the invoices, oldest first.
+func (invs *Invoices) List() []*Invoice {
+	var list []*Invoice
+	for _, inv := range invs.Invoices {
+		list = append(list, inv)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Update works out what every invoice that is not settled was paid from
+// the blocks above its height, as of now. It returns the invoices whose
+// status or state changed and how many were settled, which are worth
+// saving too.
+func (invs *Invoices) Update(chain *BlockChain, now int64) ([]*Invoice, int) {
+	if len(invs.Invoices) == 0 {
+		return nil, 0
+	}
+	bestHeight := chain.GetBestHeight()
+	medianTimePast := chain.MedianTimePast(chain.LastHash)
+
+	type before struct {
+		status InvoiceStatus
+		state  string
+	}
+	previous := make(map[int]before)
+	byPubKeyHash := make(map[string]*Invoice)
+	lowest := bestHeight
+	for id, inv := range invs.Invoices {
+		if inv.Settled {
+			continue
+		}
+		previous[id] = before{inv.Status, inv.State(bestHeight)}
+		inv.Received, inv.PaidHeight, inv.Payments = 0, -1, nil
+
+		pubKeyHash, err := wallet.PubKeyHashOf(inv.Address)
+		if err != nil {
+			continue
+		}
+		byPubKeyHash[hex.EncodeToString(pubKeyHash)] = inv
+		if inv.Height < lowest {
+			lowest = inv.Height
+		}
+	}
+
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+		if block.Height <= lowest {
+			break
+		}
+		for _, tx := range block.Transactions {
+			paid := make(map[*Invoice]bool)
+			for _, out := range tx.Outputs {
+				inv, ok := byPubKeyHash[hex.EncodeToString(out.PubKeyHash)]
+				if !ok || out.IsData() || block.Height <= inv.Height || block.Timestamp > inv.Expires {
+					continue
+				}
+				inv.Received += out.Value
+				paid[inv] = true
+			}
+			for inv := range paid {
+				inv.Payments = append(inv.Payments, tx.ID)
+				if block.Height > inv.PaidHeight {
+					inv.PaidHeight = block.Height
+				}
+			}
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	var changed []*Invoice
+	settled := 0
+	for _, inv := range invs.List() {
+		was, ok := previous[inv.ID]
+		if !ok {
+			continue
+		}
+
+		// The chain was walked newest first.
+		for i, j := 0, len(inv.Payments)-1; i < j; i, j = i+1, j-1 {
+			inv.Payments[i], inv.Payments[j] = inv.Payments[j], inv.Payments[i]
+		}
+
+		switch {
+		case inv.Received == 0 && now > inv.Expires:
+			inv.Status = InvoiceExpired
+		case inv.Received == 0:
+			inv.Status = InvoiceUnpaid
+		case inv.Received < inv.Amount:
+			inv.Status = InvoiceUnderpaid
+		case inv.Received == inv.Amount:
+			inv.Status = InvoicePaid
+		default:
+			inv.Status = InvoiceOverpaid
+		}
+
+		if inv.isSettled(bestHeight, medianTimePast) {
+			inv.Settled = true
+			settled++
+		}
+		if was.status != inv.Status || was.state != inv.State(bestHeight) {
+			changed = append(changed, inv)
+		}
+	}
+	return changed, settled
+}
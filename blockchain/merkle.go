@@ -1,6 +1,9 @@
 package blockchain
 
-import "crypto/sha256"
+import (
+	"bytes"
+	"crypto/sha256"
+)
 
 type MerkleTree struct {
 	RootNode *MerkleNode
@@ -12,6 +15,13 @@ type MerkleNode struct {
 	Data  []byte
 }
 
+// MerkleStep is one sibling hash on the path from a leaf up to the root.
+type MerkleStep struct {
+	Hash []byte
+	// Left is set when the sibling sits on the left of the running hash.
+	Left bool
+}
+
 func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 	node := MerkleNode{}
 
@@ -31,6 +41,18 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 }
 
 func NewMerkleTree(data [][]byte) *MerkleTree {
+	nodes := merkleLeaves(data)
+
+	for len(nodes) > 1 {
+		nodes = merkleLevel(nodes)
+	}
+
+	tree := MerkleTree{&nodes[0]}
+
+	return &tree
+}
+
+func merkleLeaves(data [][]byte) []MerkleNode {
 	var nodes []MerkleNode
 
 	if len(data)%2 != 0 {
@@ -41,19 +63,59 @@ func NewMerkleTree(data [][]byte) *MerkleTree {
 		node := NewMerkleNode(nil, nil, dat)
 		nodes = append(nodes, *node)
 	}
+	return nodes
+}
 
-	for i := 0; i < len(data)/2; i++ {
-		var level []MerkleNode
+// merkleLevel hashes pairs of nodes into their parents. A level with an odd
+// number of nodes pairs its last node with itself.
+func merkleLevel(nodes []MerkleNode) []MerkleNode {
+	var level []MerkleNode
 
-		for j := 0; j < len(nodes); j += 2 {
-			node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
-			level = append(level, *node)
-		}
+	if len(nodes)%2 != 0 {
+		nodes = append(nodes, nodes[len(nodes)-1])
+	}
 
-		nodes = level
+	for j := 0; j < len(nodes); j += 2 {
+		node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
+		level = append(level, *node)
 	}
+	return level
+}
 
-	tree := MerkleTree{&nodes[0]}
+// MerklePath returns the sibling hashes linking data[index] to the root of
+// the tree built from data.
+func MerklePath(data [][]byte, index int) []MerkleStep {
+	var path []MerkleStep
 
-	return &tree
+	nodes := merkleLeaves(data)
+
+	for len(nodes) > 1 {
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+		if index%2 == 0 {
+			path = append(path, MerkleStep{nodes[index+1].Data, false})
+		} else {
+			path = append(path, MerkleStep{nodes[index-1].Data, true})
+		}
+		nodes = merkleLevel(nodes)
+		index /= 2
+	}
+	return path
+}
+
+// VerifyMerklePath checks that data is a leaf of the tree with the given root.
+func VerifyMerklePath(data []byte, path []MerkleStep, root []byte) bool {
+	hash := sha256.Sum256(data)
+	current := hash[:]
+
+	for _, step := range path {
+		if step.Left {
+			hash = sha256.Sum256(append(append([]byte{}, step.Hash...), current...))
+		} else {
+			hash = sha256.Sum256(append(append([]byte{}, current...), step.Hash...))
+		}
+		current = hash[:]
+	}
+	return bytes.Equal(current, root)
 }
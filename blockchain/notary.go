@@ -0,0 +1,131 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+)
+
+// Receipt proves that a document was anchored in a block. It carries
+// everything needed to check that proof offline, without the chain.
+type Receipt struct {
+	DocumentHash []byte
+	// DocumentPath links the document hash to the notary root.
+	DocumentPath []MerkleStep
+	NotaryRoot   []byte
+
+	// Transaction is the serialized transaction holding the notary root.
+	Transaction []byte
+	TxID        []byte
+	// TxPath links the transaction to the merkle root of its block.
+	TxPath []MerkleStep
+
+	BlockHash []byte
+	Header    BlockHeader
+	Height    int
+}
+
+// HashDocument returns the hash under which a document is notarized.
+func HashDocument(document []byte) []byte {
+	hash := sha256.Sum256(document)
+	return hash[:]
+}
+
+// NotaryRoot batches document hashes into a merkle tree and returns the root
+// that gets anchored in a data output.
+func NotaryRoot(docHashes [][]byte) []byte {
+	return NewMerkleTree(docHashes).RootNode.Data
+}
+
+// NewReceipts builds a receipt for every document hash once the transaction
+// anchoring their root has been mined into block.
+func NewReceipts(docHashes [][]byte, tx *Transaction, block *Block) ([]Receipt, error) {
+	var txHashes [][]byte
+	txIndex := -1
+
+	for i, blockTx := range block.Transactions {
+		if bytes.Equal(blockTx.ID, tx.ID) {
+			txIndex = i
+		}
+		txHashes = append(txHashes, blockTx.Serialize())
+	}
+	if txIndex < 0 {
+		return nil, errors.New("transaction is not in the block")
+	}
+
+	root := NotaryRoot(docHashes)
+	txPath := MerklePath(txHashes, txIndex)
+
+	var receipts []Receipt
+	for i, docHash := range docHashes {
+		receipts = append(receipts, Receipt{
+			DocumentHash: docHash,
+			DocumentPath: MerklePath(docHashes, i),
+			NotaryRoot:   root,
+			Transaction:  tx.Serialize(),
+			TxID:         tx.ID,
+			TxPath:       txPath,
+			BlockHash:    block.Hash,
+			Header:       block.Header(),
+			Height:       block.Height,
+		})
+	}
+	return receipts, nil
+}
+
+// Verify checks every link of the receipt, from the document hash up to the
+// proof of work of the block header.
+func (r *Receipt) Verify() error {
+	if !VerifyMerklePath(r.DocumentHash, r.DocumentPath, r.NotaryRoot) {
+		return errors.New("document is not part of the notary root")
+	}
+
+	tx := DeserializeTransaction(r.Transaction)
+	if !bytes.Equal(tx.ID, r.TxID) {
+		return errors.New("transaction does not match its ID")
+	}
+
+	anchored := false
+	for _, out := range tx.Outputs {
+		if out.IsData() && bytes.Equal(out.Data, r.NotaryRoot) {
+			anchored = true
+		}
+	}
+	if !anchored {
+		return errors.New("transaction does not carry the notary root")
+	}
+
+	if !VerifyMerklePath(r.Transaction, r.TxPath, r.Header.MerkleRoot) {
+		return errors.New("transaction is not part of the block")
+	}
+	if !bytes.Equal(r.Header.Hash(), r.BlockHash) {
+		return errors.New("block header does not match the block hash")
+	}
+	if !r.Header.Validate() {
+		return errors.New("block header fails proof of work")
+	}
+	return nil
+}
+
+func (r *Receipt) SaveFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func LoadReceipt(path string) (*Receipt, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var receipt Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
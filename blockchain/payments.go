@@ -0,0 +1,131 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/TualatinX/blockchain-go/wallet"
+)
+
+// Payment is one recipient of a batch payment.
+type Payment struct {
+	Address string
+	Amount  Amount
+}
+
+// LoadPayments reads the recipients of a batch payment from a file. A file
+// ending in .json holds an array of {"address": ..., "amount": ...} objects,
+// any other file is CSV with an address and an amount on every line.
+func LoadPayments(path string) ([]Payment, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ParsePaymentsJSON(data)
+	}
+	return ParsePaymentsCSV(data)
+}
+
+// ParsePaymentsCSV reads ADDRESS,AMOUNT lines. Lines starting with # and a
+// header line are skipped.
+func ParsePaymentsCSV(data []byte) ([]Payment, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	var payments []Payment
+	var problems []string
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		amount, err := ParseAmount(strings.TrimSpace(record[1]))
+		if err != nil {
+			if first && !wallet.ValidateAddress(strings.TrimSpace(record[0])) {
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("line %d: %s", line, err))
+			continue
+		}
+		payments = append(payments, Payment{strings.TrimSpace(record[0]), amount})
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return payments, nil
+}
+
+// ParsePaymentsJSON reads an array of payments. Amounts may be written as
+// numbers or strings and are read as decimal coins without going through a
+// float.
+func ParsePaymentsJSON(data []byte) ([]Payment, error) {
+	var entries []struct {
+		Address string
+		Amount  json.RawMessage
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	var payments []Payment
+	var problems []string
+	for i, entry := range entries {
+		amount, err := ParseAmount(strings.Trim(string(entry.Amount), `"`))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("entry %d: %s", i+1, err))
+			continue
+		}
+		payments = append(payments, Payment{entry.Address, amount})
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return payments, nil
+}
+
+// PaymentOutputs checks every payment before any output is made from them,
+// and reports all the problems found at once.
+func PaymentOutputs(payments []Payment) ([]TxOutput, error) {
+	if len(payments) == 0 {
+		return nil, errors.New("no payments given")
+	}
+
+	var outputs []TxOutput
+	var problems []string
+	seen := make(map[string]bool)
+	for i, p := range payments {
+		switch {
+		case !wallet.ValidateAddress(p.Address):
+			problems = append(problems, fmt.Sprintf("payment %d: address %q is not valid", i+1, p.Address))
+		case seen[p.Address]:
+			problems = append(problems, fmt.Sprintf("payment %d: address %s is paid twice", i+1, p.Address))
+		case p.Amount <= 0:
+			problems = append(problems, fmt.Sprintf("payment %d: amount must be positive", i+1))
+		default:
+			outputs = append(outputs, *NewTXOutput(p.Amount, p.Address))
+		}
+		seen[p.Address] = true
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return outputs, nil
+}
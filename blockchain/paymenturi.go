@@ -0,0 +1,103 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/TualatinX/blockchain-go/wallet"
+)
+
+// PaymentURIScheme starts every payment request URI.
+const PaymentURIScheme = "tualatin"
+
+// PaymentURI is a request to pay an address, written as
+// tualatin:ADDRESS?amount=1.5&label=Shop&message=Order%2042. Every field
+// but the address is optional.
+type PaymentURI struct {
+	Address string
+
+	// Amount is zero when the payer chooses it.
+	Amount Amount
+
+	// Label names the payee and Message says what the payment is for.
+	Label   string
+	Message string
+}
+
+// ParsePaymentURI reads a payment request URI. Parameters it does not know
+// are ignored, unless their name starts with req-, which marks them as
+// required to understand the request.
+func ParsePaymentURI(text string) (*PaymentURI, error) {
+	u, err := url.Parse(strings.TrimSpace(text))
+	if err != nil {
+		return nil, fmt.Errorf("not a payment URI: %s", err)
+	}
+	if !strings.EqualFold(u.Scheme, PaymentURIScheme) || u.Opaque == "" {
+		return nil, fmt.Errorf("payment URI must look like %s:ADDRESS", PaymentURIScheme)
+	}
+	if !wallet.ValidateAddress(u.Opaque) {
+		return nil, fmt.Errorf("payment URI has an invalid address %q", u.Opaque)
+	}
+
+	params, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("payment URI has invalid parameters: %s", err)
+	}
+
+	p := &PaymentURI{Address: u.Opaque}
+	for name, values := range params {
+		if len(values) > 1 {
+			return nil, fmt.Errorf("payment URI repeats %s", name)
+		}
+		value := values[0]
+
+		switch name {
+		case "amount":
+			p.Amount, err = ParseAmount(value)
+			if err != nil {
+				return nil, fmt.Errorf("payment URI has an invalid amount: %s", err)
+			}
+			if p.Amount == 0 {
+				return nil, errors.New("payment URI asks for a zero amount")
+			}
+		case "label":
+			p.Label = value
+		case "message":
+			p.Message = value
+		default:
+			if strings.HasPrefix(name, "req-") {
+				return nil, fmt.Errorf("payment URI requires %s, which is not supported", name)
+			}
+		}
+	}
+	return p, nil
+}
+
+func (p *PaymentURI) String() string {
+	var params []string
+	if p.Amount > 0 {
+		// Trailing zeros of the decimals are left out.
+		amount := strings.TrimRight(p.Amount.String(), "0")
+		params = append(params, "amount="+strings.TrimSuffix(amount, "."))
+	}
+	if p.Label != "" {
+		params = append(params, "label="+uriEscape(p.Label))
+	}
+	if p.Message != "" {
+		params = append(params, "message="+uriEscape(p.Message))
+	}
+
+	uri := PaymentURIScheme + ":" + p.Address
+	if len(params) > 0 {
+		uri += "?" + strings.Join(params, "&")
+	}
+	return uri
+}
+
+// uriEscape escapes spaces as %20 rather than +, which not every reader of
+// payment URIs takes for a space.
+func uriEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
@@ -0,0 +1,196 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+)
+
+const pendingFile = "./tmp/pending_%s.data"
+
+// PendingTx is a transaction of the wallet that is not in the chain yet.
+type PendingTx struct {
+	Tx Transaction
+
+	// Broadcast is false while the transaction has not been sent, such as
+	// an unsigned transaction waiting for signpsbt. Its outputs can not be
+	// spent since its ID changes once it is signed.
+	Broadcast bool
+}
+
+// PendingTxs is the wallet's own view of the transactions it made that are
+// not confirmed yet. The outputs they spend are locked so that they are not
+// picked again, and their outputs can be spent before they confirm.
+type PendingTxs struct {
+	Txs map[string]*PendingTx
+}
+
+func LoadPendingTxs(nodeId string) *PendingTxs {
+	p := &PendingTxs{make(map[string]*PendingTx)}
+
+	data, err := ioutil.ReadFile(fmt.Sprintf(pendingFile, nodeId))
+	if err != nil {
+		return p
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(p); err != nil || p.Txs == nil {
+		return &PendingTxs{make(map[string]*PendingTx)}
+	}
+	return p
+}
+
+func (p *PendingTxs) SaveFile(nodeId string) {
+	var content bytes.Buffer
+
+	err := gob.NewEncoder(&content).Encode(p)
+	Handle(err)
+
+	err = ioutil.WriteFile(fmt.Sprintf(pendingFile, nodeId), content.Bytes(), 0644)
+	Handle(err)
+}
+
+func (p *PendingTxs) lookup(id string) (*PendingTx, bool) {
+	if p == nil {
+		return nil, false
+	}
+	pending, ok := p.Txs[id]
+	return pending, ok
+}
+
+func (p *PendingTxs) Add(tx *Transaction, broadcast bool) {
+	p.Txs[hex.EncodeToString(tx.ID)] = &PendingTx{*tx, broadcast}
+}
+
+// Abandon forgets a pending transaction and the ones spending its outputs,
+// unlocking what they spend. It returns how many were removed.
+func (p *PendingTxs) Abandon(txID []byte) int {
+	id := hex.EncodeToString(txID)
+	if _, ok := p.Txs[id]; !ok {
+		return 0
+	}
+	delete(p.Txs, id)
+
+	removed := 1
+	for _, pending := range p.Txs {
+		for _, in := range pending.Tx.Inputs {
+			if bytes.Equal(in.ID, txID) {
+				removed += p.Abandon(pending.Tx.ID)
+				break
+			}
+		}
+	}
+	return removed
+}
+
+// Sync drops the transactions that made it into the chain, and the ones that
+// never will because an output they spend was spent by another transaction.
+func (p *PendingTxs) Sync(u UTXOSet) {
+	for id, pending := range p.Txs {
+		if _, err := u.Blockchain.FindTransactions(pending.Tx.ID); err == nil {
+			delete(p.Txs, id)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for id, pending := range p.Txs {
+			for _, in := range pending.Tx.Inputs {
+				_, parent := p.Txs[hex.EncodeToString(in.ID)]
+				if !parent && !u.IsUnspent(in.ID, in.Out) {
+					delete(p.Txs, id)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// Unconfirmed returns the broadcast pending transactions by hex ID.
+func (p *PendingTxs) Unconfirmed() map[string]*Transaction {
+	txs := make(map[string]*Transaction)
+	for id, pending := range p.Txs {
+		if pending.Broadcast {
+			txs[id] = &pending.Tx
+		}
+	}
+	return txs
+}
+
+// IsLocked tells whether a pending transaction spends output out of txID.
+func (p *PendingTxs) IsLocked(txID []byte, out int) bool {
+	for _, pending := range p.Txs {
+		for _, in := range pending.Tx.Inputs {
+			if in.Out == out && bytes.Equal(in.ID, txID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Unlocked leaves out the coins spent by pending transactions.
+func (p *PendingTxs) Unlocked(coins []SpendableOutput) []SpendableOutput {
+	var unlocked []SpendableOutput
+	for _, c := range coins {
+		if !p.IsLocked(c.TxID, c.Out) {
+			unlocked = append(unlocked, c)
+		}
+	}
+	return unlocked
+}
+
+// Outputs returns the unspent outputs of broadcast pending transactions that
+// are locked to pubKeyHash.
+func (p *PendingTxs) Outputs(pubKeyHash []byte) []SpendableOutput {
+	var coins []SpendableOutput
+	for _, pending := range p.Txs {
+		if !pending.Broadcast {
+			continue
+		}
+		for outId, out := range pending.Tx.Outputs {
+			if out.IsLockedWithKey(pubKeyHash) && !p.IsLocked(pending.Tx.ID, outId) {
+				coins = append(coins, SpendableOutput{pending.Tx.ID, outId, out.Value})
+			}
+		}
+	}
+	return coins
+}
+
+// Balances returns what pending transactions lock of the spendable outputs
+// of pubKeyHash, and what they will pay to it once confirmed.
+func (p *PendingTxs) Balances(u UTXOSet, pubKeyHash []byte) (locked, pending Amount) {
+	for _, c := range u.FindSpendableOutputs(pubKeyHash) {
+		if p.IsLocked(c.TxID, c.Out) {
+			locked += c.Value
+		}
+	}
+	for _, c := range p.Outputs(pubKeyHash) {
+		pending += c.Value
+	}
+	return locked, pending
+}
+
+// Ancestors returns the pending transactions tx depends on, parents first.
+func (p *PendingTxs) Ancestors(tx *Transaction) []*Transaction {
+	var ancestors []*Transaction
+	seen := make(map[string]bool)
+
+	var visit func(tx *Transaction)
+	visit = func(tx *Transaction) {
+		for _, in := range tx.Inputs {
+			id := hex.EncodeToString(in.ID)
+			parent, ok := p.Txs[id]
+			if !ok || seen[id] {
+				continue
+			}
+			seen[id] = true
+			visit(&parent.Tx)
+			ancestors = append(ancestors, &parent.Tx)
+		}
+	}
+	visit(tx)
+
+	return ancestors
+}
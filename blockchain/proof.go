@@ -35,16 +35,30 @@ func ToHex(num int64) []byte {
 }
 
 func (pow *ProofOfWork) InitData(nonce int) []byte {
-	data := bytes.Join(
-		[][]byte{
-			pow.Block.PrevHash,
-			pow.Block.HashTransactions(),
-			ToHex(int64(nonce)),
-			ToHex(int64(Difficulty)),
-		},
-		[]byte{},
-	)
-	return data
+	header := pow.Block.Header()
+	header.Nonce = nonce
+	return header.data()
+}
+
+// data is what the header hash commits to. Headers of version 0 blocks
+// leave out the version and timestamp, so that blocks mined before those
+// were committed to keep their hashes.
+func (h BlockHeader) data() []byte {
+	fields := [][]byte{
+		h.PrevHash,
+		h.MerkleRoot,
+		ToHex(int64(h.Nonce)),
+		ToHex(int64(Difficulty)),
+	}
+	if h.Version > 0 {
+		fields = append([][]byte{ToHex(int64(h.Version)), ToHex(h.Timestamp)}, fields...)
+	}
+	return bytes.Join(fields, []byte{})
+}
+
+func (h BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.data())
+	return hash[:]
 }
 
 func (pow *ProofOfWork) Run() (int, []byte) {
@@ -73,12 +87,17 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 }
 
 func (pow *ProofOfWork) Validate() bool {
+	return pow.Block.Header().Validate()
+}
+
+// Validate checks that the header hash meets the proof of work target.
+func (h BlockHeader) Validate() bool {
 	var intHash big.Int
 
-	data := pow.InitData(pow.Block.Nonce)
+	target := big.NewInt(1)
+	target.Lsh(target, uint(256-Difficulty))
 
-	hash := sha256.Sum256(data)
-	intHash.SetBytes(hash[:])
+	intHash.SetBytes(h.Hash())
 
-	return intHash.Cmp(pow.Target) == -1
+	return intHash.Cmp(target) == -1
 }
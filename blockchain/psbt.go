@@ -0,0 +1,251 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/TualatinX/blockchain-go/wallet"
+)
+
+// psbtMagic starts every encoded partially signed transaction.
+var psbtMagic = []byte("psbt\xff")
+
+// PSBT is a partially signed transaction. It carries the unsigned
+// transaction together with the transactions its inputs spend, so that it
+// can be signed by keys kept away from the chain, and collects the
+// signatures of each party until every input is signed.
+type PSBT struct {
+	// Tx is the transaction with its signatures and public keys left out.
+	Tx Transaction
+
+	// Inputs follow the inputs of Tx.
+	Inputs []PSBTInput
+}
+
+type PSBTInput struct {
+	// PrevTx is the transaction whose output the input spends. Signers
+	// check its hash against the input before trusting the value and key
+	// of the output, since the signature does not commit to the value.
+	PrevTx Transaction
+
+	// PubKey and Signature are empty until the input is signed.
+	PubKey    []byte
+	Signature []byte
+}
+
+func (in *PSBTInput) IsSigned() bool {
+	return len(in.Signature) > 0
+}
+
+// NewPSBT wraps a transaction, looking up the outputs spent by its inputs.
+// Signatures the transaction already has are kept.
+func (chain *BlockChain) NewPSBT(tx *Transaction) (*PSBT, error) {
+	if tx.IsCoinbase() {
+		return nil, errors.New("a coinbase can not be signed")
+	}
+	if len(tx.Inputs) == 0 || len(tx.Outputs) == 0 {
+		return nil, errors.New("transaction needs at least one input and one output")
+	}
+
+	p := &PSBT{Tx: tx.TrimmedCopy()}
+	for inId, in := range tx.Inputs {
+		prevTx, err := chain.FindTransactions(in.ID)
+		if err != nil {
+			return nil, fmt.Errorf("input %d spends unknown transaction %x", inId, in.ID)
+		}
+		if in.Out < 0 || in.Out >= len(prevTx.Outputs) || prevTx.Outputs[in.Out].IsData() {
+			return nil, fmt.Errorf("input %d spends missing output %d", inId, in.Out)
+		}
+		p.Inputs = append(p.Inputs, PSBTInput{prevTx, in.PubKey, in.Signature})
+	}
+	p.Tx.ID = p.Tx.Hash()
+	return p, nil
+}
+
+func (p *PSBT) Encode() string {
+	var content bytes.Buffer
+	content.Write(psbtMagic)
+
+	err := gob.NewEncoder(&content).Encode(p)
+	Handle(err)
+
+	return base64.StdEncoding.EncodeToString(content.Bytes())
+}
+
+func DecodePSBT(text string) (*PSBT, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil || !bytes.HasPrefix(data, psbtMagic) {
+		return nil, errors.New("not a partially signed transaction")
+	}
+
+	var p PSBT
+	if err := gob.NewDecoder(bytes.NewReader(data[len(psbtMagic):])).Decode(&p); err != nil {
+		return nil, fmt.Errorf("not a partially signed transaction: %s", err)
+	}
+	if len(p.Inputs) != len(p.Tx.Inputs) {
+		return nil, errors.New("partially signed transaction is missing inputs")
+	}
+	return &p, nil
+}
+
+// PrevOut returns the output spent by input inId, after making sure the
+// transaction carried for it is the one the input names.
+func (p *PSBT) PrevOut(inId int) (TxOutput, error) {
+	in, prevTx := p.Tx.Inputs[inId], p.Inputs[inId].PrevTx
+	if !bytes.Equal(prevTx.ID, in.ID) || !bytes.Equal(prevTx.Hash(), in.ID) {
+		return TxOutput{}, fmt.Errorf("input %d carries the wrong transaction for %x", inId, in.ID)
+	}
+	if in.Out < 0 || in.Out >= len(prevTx.Outputs) || prevTx.Outputs[in.Out].IsData() {
+		return TxOutput{}, fmt.Errorf("input %d spends missing output %d", inId, in.Out)
+	}
+	return prevTx.Outputs[in.Out], nil
+}
+
+// Spends tells whether an unsigned input spends an output locked to
+// pubKeyHash.
+func (p *PSBT) Spends(pubKeyHash []byte) bool {
+	for inId, in := range p.Inputs {
+		prevOut, err := p.PrevOut(inId)
+		if err == nil && !in.IsSigned() && prevOut.IsLockedWithKey(pubKeyHash) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign signs every unsigned input that spends an output locked to the
+// wallet and returns how many were signed. It needs no access to the chain,
+// but nothing is signed unless every input carries the transaction it
+// spends, so the fee can be trusted.
+func (p *PSBT) Sign(w *wallet.Wallet, hashType SigHashType) (int, error) {
+	if _, err := p.Fee(); err != nil {
+		return 0, err
+	}
+	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+	signed := 0
+
+	for inId := range p.Inputs {
+		in := &p.Inputs[inId]
+		prevOut, _ := p.PrevOut(inId)
+		if in.IsSigned() || !prevOut.IsLockedWithKey(pubKeyHash) {
+			continue
+		}
+
+		hash, err := p.Tx.SigHash(inId, prevOut.PubKeyHash, hashType)
+		if err != nil {
+			return signed, err
+		}
+		signature, err := w.Sign(hash)
+		if err != nil {
+			return signed, err
+		}
+
+		in.PubKey = w.PublicKey
+		in.Signature = append(signature, byte(hashType))
+		signed++
+	}
+	return signed, nil
+}
+
+// Signed returns how many inputs have been signed.
+func (p *PSBT) Signed() int {
+	signed := 0
+	for _, in := range p.Inputs {
+		if in.IsSigned() {
+			signed++
+		}
+	}
+	return signed
+}
+
+// Fee is what the inputs are worth beyond the outputs.
+func (p *PSBT) Fee() (Amount, error) {
+	var values []Amount
+	for inId := range p.Inputs {
+		prevOut, err := p.PrevOut(inId)
+		if err != nil {
+			return 0, err
+		}
+		values = append(values, prevOut.Value)
+	}
+	in, err := SumAmounts(values...)
+	if err != nil {
+		return 0, err
+	}
+	out, err := p.Tx.OutputValue()
+	if err != nil {
+		return 0, err
+	}
+	if in < out {
+		return 0, fmt.Errorf("outputs spend %s but inputs are worth only %s", out, in)
+	}
+	return in - out, nil
+}
+
+// CombinePSBT merges the signatures of copies of the same transaction
+// signed by different parties.
+func CombinePSBT(psbts ...*PSBT) (*PSBT, error) {
+	if len(psbts) == 0 {
+		return nil, errors.New("nothing to combine")
+	}
+
+	combined := *psbts[0]
+	combined.Inputs = append([]PSBTInput{}, psbts[0].Inputs...)
+	for _, p := range psbts[1:] {
+		if !bytes.Equal(p.Tx.Hash(), combined.Tx.Hash()) {
+			return nil, errors.New("partially signed transactions are for different transactions")
+		}
+		for inId, in := range p.Inputs {
+			if !in.IsSigned() {
+				continue
+			}
+			have := combined.Inputs[inId]
+			if have.IsSigned() && (!bytes.Equal(have.PubKey, in.PubKey) || !bytes.Equal(have.Signature, in.Signature)) {
+				return nil, fmt.Errorf("input %d has conflicting signatures", inId)
+			}
+			combined.Inputs[inId] = in
+		}
+	}
+	return &combined, nil
+}
+
+// Finalize checks every signature and returns the signed transaction.
+func (p *PSBT) Finalize() (*Transaction, error) {
+	tx := p.Tx.TrimmedCopy()
+
+	for inId, in := range p.Inputs {
+		if !in.IsSigned() {
+			return nil, fmt.Errorf("input %d is not signed", inId)
+		}
+		prevOut, err := p.PrevOut(inId)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(wallet.PublicKeyHash(in.PubKey), prevOut.PubKeyHash) {
+			return nil, fmt.Errorf("input %d is signed with the wrong key", inId)
+		}
+		if len(in.Signature) != wallet.SignatureLength+1 {
+			return nil, fmt.Errorf("input %d has a malformed signature", inId)
+		}
+
+		hashType := SigHashType(in.Signature[len(in.Signature)-1])
+		hash, err := p.Tx.SigHash(inId, prevOut.PubKeyHash, hashType)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %s", inId, err)
+		}
+		if !(sigCheck{hash, in.PubKey, in.Signature[:len(in.Signature)-1]}).verify() {
+			return nil, fmt.Errorf("input %d has an invalid signature", inId)
+		}
+
+		tx.Inputs[inId].PubKey = in.PubKey
+		tx.Inputs[inId].Signature = in.Signature
+	}
+
+	// The ID covers the public keys added above, not the signatures.
+	tx.ID = tx.Hash()
+	return &tx, nil
+}
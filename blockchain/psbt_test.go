@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/TualatinX/blockchain-go/wallet"
+)
+
+// TestPSBTSpendsBuiltOutput takes an output of a transaction made by
+// TxBuilder, as send makes them, through createpsbt, signpsbt and
+// finalizepsbt. The PSBT carries that transaction, signed, and has to find
+// its ID matching the input that spends it.
+func TestPSBTSpendsBuiltOutput(t *testing.T) {
+	dir, err := os.Getwd()
+	Handle(err)
+	Handle(os.Chdir(t.TempDir()))
+	Handle(os.Mkdir("tmp", 0755))
+	t.Cleanup(func() { os.Chdir(dir) })
+
+	maturity := CoinbaseMaturity
+	CoinbaseMaturity = 0
+	t.Cleanup(func() { CoinbaseMaturity = maturity })
+
+	w := wallet.MakeWallet()
+	address := string(w.Address())
+
+	chain := InitBlockChain(address, "psbt")
+	t.Cleanup(func() { chain.Database.Close() })
+	UTXOSet := UTXOSet{chain}
+	UTXOSet.ReIndex()
+
+	sent, err := NewTxBuilder(w, &UTXOSet).Build([]TxOutput{*NewTXOutput(Coin, address)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sent.ID, sent.Hash()) {
+		t.Fatal("signing changed the ID of the built transaction")
+	}
+	chain.MineBlock([]*Transaction{CoinbaseTx(address, ""), sent})
+	UTXOSet.ReIndex()
+
+	tx := Transaction{nil, []TxInput{{sent.ID, 0, nil, nil, SequenceFinal}}, []TxOutput{*NewTXOutput(Coin-Coin/1000, address)}}
+	tx.ID = tx.Hash()
+	created, err := chain.NewPSBT(&tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := DecodePSBT(created.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee, err := p.Fee(); err != nil || fee != Coin/1000 {
+		t.Fatalf("fee is %s (%v), want %s", fee, err, Coin/1000)
+	}
+	if signed, err := p.Sign(w, SigHashAll); err != nil || signed != 1 {
+		t.Fatalf("signed %d inputs (%v), want 1", signed, err)
+	}
+
+	p, err = DecodePSBT(p.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	final, err := p.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(final.ID, final.Hash()) {
+		t.Error("finalized transaction does not have its ID")
+	}
+	if err := chain.ValidateTransaction(final, chain.GetBestHeight()+1); err != nil {
+		t.Errorf("finalized transaction is invalid: %s", err)
+	}
+}
@@ -0,0 +1,84 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/TualatinX/blockchain-go/wallet"
+)
+
+// EncodeRawTransaction turns a transaction into the hex text passed between
+// the raw transaction commands.
+func EncodeRawTransaction(tx *Transaction) string {
+	return hex.EncodeToString(tx.Serialize())
+}
+
+func DecodeRawTransaction(raw string) (*Transaction, error) {
+	data, err := hex.DecodeString(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	var tx Transaction
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&tx); err != nil {
+		return nil, fmt.Errorf("not a raw transaction: %s", err)
+	}
+	return &tx, nil
+}
+
+// ParseOutpoint reads an output reference written as TXID:INDEX into an
+// unsigned input.
+func ParseOutpoint(s string) (TxInput, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return TxInput{}, fmt.Errorf("input %q is not TXID:INDEX", s)
+	}
+	txID, err := hex.DecodeString(parts[0])
+	if err != nil || len(txID) == 0 {
+		return TxInput{}, fmt.Errorf("input %q has an invalid transaction ID", s)
+	}
+	out, err := strconv.Atoi(parts[1])
+	if err != nil || out < 0 {
+		return TxInput{}, fmt.Errorf("input %q has an invalid output index", s)
+	}
+	return TxInput{txID, out, nil, nil, SequenceFinal}, nil
+}
+
+// SignRawTransaction signs every input of tx that spends an output locked to
+// the wallet and returns how many inputs were signed. Inputs belonging to
+// other keys are left for their owners to sign.
+func (chain *BlockChain) SignRawTransaction(tx *Transaction, w *wallet.Wallet, hashType SigHashType) (int, error) {
+	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+	signed := 0
+
+	for inId, in := range tx.Inputs {
+		prevTx, err := chain.FindTransactions(in.ID)
+		if err != nil {
+			return signed, fmt.Errorf("input %d spends unknown transaction %x", inId, in.ID)
+		}
+		if in.Out < 0 || in.Out >= len(prevTx.Outputs) {
+			return signed, fmt.Errorf("input %d spends missing output %d", inId, in.Out)
+		}
+		prevOut := prevTx.Outputs[in.Out]
+		if !prevOut.IsLockedWithKey(pubKeyHash) {
+			continue
+		}
+
+		tx.Inputs[inId].PubKey = w.PublicKey
+		if err := tx.SignInput(inId, w, prevOut.PubKeyHash, hashType); err != nil {
+			return signed, err
+		}
+		signed++
+	}
+
+	if signed == 0 {
+		return 0, errors.New("no input spends an output of this wallet")
+	}
+	tx.ID = tx.Hash()
+	return signed, nil
+}
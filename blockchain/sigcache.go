@@ -0,0 +1,137 @@
+package blockchain
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/TualatinX/blockchain-go/wallet"
+)
+
+// sigCacheSize is how many verified signatures are remembered.
+const sigCacheSize = 50000
+
+// SigCache is an LRU set of signatures that already passed verification, so
+// a transaction checked on its way into the mempool is not checked again
+// when it shows up in a block.
+type SigCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[[32]byte]*list.Element
+	order    *list.List
+}
+
+var sigCache = NewSigCache(sigCacheSize)
+
+// SigCheckWorkers is how many signatures are verified at the same time.
+var SigCheckWorkers = runtime.NumCPU()
+
+func NewSigCache(capacity int) *SigCache {
+	return &SigCache{
+		capacity: capacity,
+		entries:  make(map[[32]byte]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func sigCacheKey(digest, publicKey, signature []byte) [32]byte {
+	hasher := sha256.New()
+	hasher.Write(digest)
+	hasher.Write(publicKey)
+	hasher.Write(signature)
+
+	var key [32]byte
+	copy(key[:], hasher.Sum(nil))
+	return key
+}
+
+func (c *SigCache) Contains(digest, publicKey, signature []byte) bool {
+	key := sigCacheKey(digest, publicKey, signature)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if ok {
+		c.order.MoveToFront(element)
+	}
+	return ok
+}
+
+func (c *SigCache) Add(digest, publicKey, signature []byte) {
+	key := sigCacheKey(digest, publicKey, signature)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(key)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.([32]byte))
+	}
+}
+
+// sigCheck is one input signature waiting to be verified.
+type sigCheck struct {
+	digest    []byte
+	publicKey []byte
+	signature []byte
+}
+
+func (c sigCheck) verify() bool {
+	if sigCache.Contains(c.digest, c.publicKey, c.signature) {
+		return true
+	}
+	if !wallet.VerifySignature(c.publicKey, c.digest, c.signature) {
+		return false
+	}
+	sigCache.Add(c.digest, c.publicKey, c.signature)
+	return true
+}
+
+// verifySigChecks verifies signatures on a pool of SigCheckWorkers workers
+// and stops handing out work once one of them fails.
+func verifySigChecks(checks []sigCheck) bool {
+	workers := SigCheckWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(checks) {
+		workers = len(checks)
+	}
+
+	var failed int32
+	var wg sync.WaitGroup
+	jobs := make(chan sigCheck)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for check := range jobs {
+				if atomic.LoadInt32(&failed) == 0 && !check.verify() {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	for _, check := range checks {
+		if atomic.LoadInt32(&failed) != 0 {
+			break
+		}
+		jobs <- check
+	}
+	close(jobs)
+	wg.Wait()
+
+	return failed == 0
+}
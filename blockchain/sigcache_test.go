@@ -0,0 +1,143 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/TualatinX/blockchain-go/wallet"
+)
+
+// benchmarkTxs is how many transactions the benchmark blocks hold.
+const benchmarkTxs = 200
+
+// benchmarkChain builds a chain in a temporary directory whose last block
+// splits a coinbase into benchmarkTxs outputs. It returns the chain, the
+// splitting transaction and a block on top of the chain that spends each of
+// its outputs in a transaction of its own. The block is not stored, so it
+// can be validated again and again.
+func benchmarkChain(b *testing.B) (*BlockChain, *Transaction, *Block) {
+	b.Helper()
+
+	dir, err := os.Getwd()
+	Handle(err)
+	Handle(os.Chdir(b.TempDir()))
+	Handle(os.Mkdir("tmp", 0755))
+	b.Cleanup(func() { os.Chdir(dir) })
+
+	maturity := CoinbaseMaturity
+	CoinbaseMaturity = 0
+	b.Cleanup(func() { CoinbaseMaturity = maturity })
+
+	w := wallet.MakeWallet()
+	address := string(w.Address())
+	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+
+	chain := InitBlockChain(address, "bench")
+	b.Cleanup(func() { chain.Database.Close() })
+	genesis := chain.getLastBlock()
+	coinbase := genesis.Transactions[0]
+
+	value := reward / Amount(benchmarkTxs+1)
+	split := &Transaction{nil, []TxInput{{coinbase.ID, 0, nil, w.PublicKey, SequenceFinal}}, nil}
+	for i := 0; i < benchmarkTxs; i++ {
+		split.Outputs = append(split.Outputs, TxOutput{value, pubKeyHash, nil})
+	}
+	split.ID = split.Hash()
+	split.Sign(w, map[string]Transaction{hex.EncodeToString(coinbase.ID): *coinbase})
+	chain.MineBlock([]*Transaction{CoinbaseTx(address, ""), split})
+
+	txs := []*Transaction{CoinbaseTx(address, "")}
+	prevTXs := map[string]Transaction{hex.EncodeToString(split.ID): *split}
+	for i := range split.Outputs {
+		tx := &Transaction{nil, []TxInput{{split.ID, i, nil, w.PublicKey, SequenceFinal}}, []TxOutput{{value - Coin/1000, pubKeyHash, nil}}}
+		tx.ID = tx.Hash()
+		tx.Sign(w, prevTXs)
+		txs = append(txs, tx)
+	}
+
+	// The blocks are mined within the same second, so the timestamp has to
+	// be set past their median.
+	timestamp := chain.MedianTimePast(chain.LastHash) + 1
+	return chain, split, CreateBlock(txs, chain.LastHash, chain.GetBestHeight()+1, timestamp)
+}
+
+// sigCheckModes are the ways signatures can be verified: one at a time or
+// on the worker pool, with a cache that already holds them or none at all.
+var sigCheckModes = []struct {
+	name    string
+	workers int
+	cached  bool
+}{
+	{"serial/uncached", 1, false},
+	{"pool/uncached", runtime.NumCPU(), false},
+	{"serial/cached", 1, true},
+	{"pool/cached", runtime.NumCPU(), true},
+}
+
+// useSigCheckMode sets up the workers and cache of a mode until the
+// benchmark ends. A cache of capacity 0 forgets every signature at once.
+func useSigCheckMode(b *testing.B, workers int, cached bool) {
+	oldWorkers, oldCache := SigCheckWorkers, sigCache
+	b.Cleanup(func() { SigCheckWorkers, sigCache = oldWorkers, oldCache })
+
+	SigCheckWorkers = workers
+	if cached {
+		sigCache = NewSigCache(sigCacheSize)
+	} else {
+		sigCache = NewSigCache(0)
+	}
+}
+
+func BenchmarkValidateBlock(b *testing.B) {
+	chain, _, block := benchmarkChain(b)
+
+	for _, mode := range sigCheckModes {
+		b.Run(mode.name, func(b *testing.B) {
+			useSigCheckMode(b, mode.workers, mode.cached)
+			if err := chain.ValidateBlock(block); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := chain.ValidateBlock(block); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkVerifySigChecks leaves out the lookups of spent outputs, to
+// measure only what the cache and worker pool speed up.
+func BenchmarkVerifySigChecks(b *testing.B) {
+	_, split, block := benchmarkChain(b)
+
+	prevTXs := map[string]Transaction{hex.EncodeToString(split.ID): *split}
+	var checks []sigCheck
+	for _, tx := range block.Transactions[1:] {
+		txChecks, ok := tx.sigChecks(prevTXs)
+		if !ok {
+			b.Fatal("transaction does not verify")
+		}
+		checks = append(checks, txChecks...)
+	}
+
+	for _, mode := range sigCheckModes {
+		b.Run(mode.name, func(b *testing.B) {
+			useSigCheckMode(b, mode.workers, mode.cached)
+			if !verifySigChecks(checks) {
+				b.Fatal("signatures do not verify")
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !verifySigChecks(checks) {
+					b.Fatal("signatures do not verify")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// SigHashType selects which parts of a transaction a signature commits to.
+type SigHashType byte
+
+const (
+	// SigHashAll signs every input and every output.
+	SigHashAll SigHashType = 0x01
+	// SigHashNone signs the inputs but none of the outputs, so anyone may
+	// decide where the coins go.
+	SigHashNone SigHashType = 0x02
+	// SigHashSingle signs only the output with the same index as the input.
+	SigHashSingle SigHashType = 0x03
+	// SigHashAnyoneCanPay is combined with the others to sign only the
+	// input being signed, so other inputs may be added later.
+	SigHashAnyoneCanPay SigHashType = 0x80
+)
+
+func (t SigHashType) base() SigHashType {
+	return t &^ SigHashAnyoneCanPay
+}
+
+func (t SigHashType) IsValid() bool {
+	base := t.base()
+	return base == SigHashAll || base == SigHashNone || base == SigHashSingle
+}
+
+func (t SigHashType) String() string {
+	var name string
+	switch t.base() {
+	case SigHashAll:
+		name = "ALL"
+	case SigHashNone:
+		name = "NONE"
+	case SigHashSingle:
+		name = "SINGLE"
+	default:
+		return fmt.Sprintf("UNKNOWN(%#x)", byte(t))
+	}
+	if t&SigHashAnyoneCanPay != 0 {
+		name += "|ANYONECANPAY"
+	}
+	return name
+}
+
+// ParseSigHashType reads names such as "ALL" or "SINGLE|ANYONECANPAY".
+func ParseSigHashType(s string) (SigHashType, error) {
+	flags := strings.Split(strings.ToUpper(s), "|")
+	if len(flags) > 2 {
+		return 0, fmt.Errorf("invalid sighash type %q", s)
+	}
+
+	var hashType SigHashType
+	switch flags[0] {
+	case "ALL":
+		hashType = SigHashAll
+	case "NONE":
+		hashType = SigHashNone
+	case "SINGLE":
+		hashType = SigHashSingle
+	default:
+		return 0, fmt.Errorf("invalid sighash type %q", s)
+	}
+
+	if len(flags) == 2 {
+		if flags[1] != "ANYONECANPAY" {
+			return 0, fmt.Errorf("invalid sighash type %q", s)
+		}
+		hashType |= SigHashAnyoneCanPay
+	}
+	return hashType, nil
+}
+
+// SigHash builds the digest signed by input inId. The trimmed copy of the
+// transaction is cut down according to hashType, the input being signed
+// carries the key hash of the output it spends, and the hash type itself is
+// appended so that a signature cannot be reused under another type.
+func (tx *Transaction) SigHash(inId int, prevPubKeyHash []byte, hashType SigHashType) ([]byte, error) {
+	if !hashType.IsValid() {
+		return nil, fmt.Errorf("invalid sighash type %#x", byte(hashType))
+	}
+	if inId < 0 || inId >= len(tx.Inputs) {
+		return nil, fmt.Errorf("input %d does not exist", inId)
+	}
+
+	txCopy := tx.TrimmedCopy()
+	txCopy.Inputs[inId].PubKey = prevPubKeyHash
+
+	switch hashType.base() {
+	case SigHashNone:
+		txCopy.Outputs = nil
+	case SigHashSingle:
+		if inId >= len(txCopy.Outputs) {
+			return nil, fmt.Errorf("input %d has no matching output for SINGLE", inId)
+		}
+		// Outputs before the signed one are blanked, so only their
+		// position is committed to.
+		txCopy.Outputs = txCopy.Outputs[:inId+1]
+		for i := 0; i < inId; i++ {
+			txCopy.Outputs[i] = TxOutput{}
+		}
+	}
+
+	if hashType&SigHashAnyoneCanPay != 0 {
+		txCopy.Inputs = []TxInput{txCopy.Inputs[inId]}
+	}
+
+	hash := sha256.Sum256(append(txCopy.Serialize(), byte(hashType)))
+	return hash[:], nil
+}
@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// minTimeSamples is how many peers must report their clock before the
+	// local clock gets adjusted.
+	minTimeSamples = 5
+
+	maxTimeSamples = 200
+
+	// maxTimeAdjustment is the largest offset applied to the local clock.
+	// Peers claiming a larger one are more likely wrong than we are.
+	maxTimeAdjustment = 70 * 60
+)
+
+var (
+	timeMutex   sync.Mutex
+	timeOffsets = make(map[string]int64)
+	timeOffset  int64
+)
+
+// AddTimeSample records the clock of a peer as reported in its version
+// message and recomputes the network time offset.
+func AddTimeSample(peer string, peerTime int64) {
+	timeMutex.Lock()
+	defer timeMutex.Unlock()
+
+	if _, ok := timeOffsets[peer]; !ok && len(timeOffsets) >= maxTimeSamples {
+		return
+	}
+	timeOffsets[peer] = peerTime - time.Now().Unix()
+
+	if len(timeOffsets) < minTimeSamples {
+		return
+	}
+
+	var offsets []int64
+	for _, offset := range timeOffsets {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	median := offsets[len(offsets)/2]
+
+	if median > maxTimeAdjustment || median < -maxTimeAdjustment {
+		fmt.Printf("Peers report a clock offset of %ds, please check the time of this node\n", median)
+		timeOffset = 0
+		return
+	}
+	timeOffset = median
+}
+
+// AdjustedTime is the local clock corrected by the median offset of peers.
+func AdjustedTime() int64 {
+	timeMutex.Lock()
+	defer timeMutex.Unlock()
+
+	return time.Now().Unix() + timeOffset
+}
@@ -2,21 +2,20 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
-	"math/big"
+	"sort"
 	"strings"
 
 	"github.com/TualatinX/blockchain-go/wallet"
 )
 
-const reward = 100
+const reward = 20 * Coin
 
 type Transaction struct {
 	ID      []byte
@@ -33,12 +32,22 @@ func (tx Transaction) String() string {
 		lines = append(lines, fmt.Sprintf("\t\tTXID: %x", input.ID))
 		lines = append(lines, fmt.Sprintf("\t\tOut: %d", input.Out))
 		lines = append(lines, fmt.Sprintf("\t\tSignature: %x", input.Signature))
+		if len(input.Signature) > 0 {
+			lines = append(lines, fmt.Sprintf("\t\tSigHash: %s", SigHashType(input.Signature[len(input.Signature)-1])))
+		}
 		lines = append(lines, fmt.Sprintf("\t\tPubKey: %x", input.PubKey))
+		if input.Sequence != SequenceFinal {
+			lines = append(lines, fmt.Sprintf("\t\tSequence: %d", input.Sequence))
+		}
 	}
 
 	for outputId, output := range tx.Outputs {
 		lines = append(lines, fmt.Sprintf("\tOutput %d", outputId))
-		lines = append(lines, fmt.Sprintf("\t\tValue: %d", output.Value))
+		if output.IsData() {
+			lines = append(lines, fmt.Sprintf("\t\tData: %x", output.Data))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("\t\tValue: %s", output.Value))
 		lines = append(lines, fmt.Sprintf("\t\tPubKeyHash: %x", output.PubKeyHash))
 	}
 
@@ -66,11 +75,20 @@ func DeserializeTransaction(data []byte) Transaction {
 	return transaction
 }
 
+// Hash returns the ID of the transaction: the hash of it with the ID and
+// the signatures left out. Signing does not change it, so the ID can be set
+// before the inputs are signed and still be checked against the signed
+// transaction.
 func (tx *Transaction) Hash() []byte {
 	var hash [32]byte
 
 	txCopy := *tx
 	txCopy.ID = []byte{}
+	txCopy.Inputs = make([]TxInput, len(tx.Inputs))
+	for i, in := range tx.Inputs {
+		in.Signature = nil
+		txCopy.Inputs[i] = in
+	}
 
 	hash = sha256.Sum256(txCopy.Serialize())
 
@@ -87,9 +105,9 @@ func CoinbaseTx(toAddress, data string) *Transaction {
 	}
 	// Since this is the "first" transaction of the block, it has no previous output to reference.
 	// This means that we initialize it with no ID, and it's OutputIndex is -1
-	txIn := TxInput{[]byte{}, -1, nil, []byte(data)}
+	txIn := TxInput{[]byte{}, -1, nil, []byte(data), SequenceFinal}
 	// txOut will represent the amount of tokens(reward) given to the person(toAddress) that executed CoinbaseTx
-	txOut := NewTXOutput(20, toAddress) // You can see it follows {value, PubKey}
+	txOut := NewTXOutput(reward, toAddress) // You can see it follows {value, PubKey}
 
 	tx := Transaction{nil, []TxInput{txIn}, []TxOutput{*txOut}}
 	tx.ID = tx.Hash()
@@ -110,50 +128,237 @@ func (tx *Transaction) SetID() {
 	tx.ID = hash[:]
 }
 
+// IsReplaceable tells whether tx signals replace-by-fee on any input.
+func (tx *Transaction) IsReplaceable() bool {
+	for _, in := range tx.Inputs {
+		if in.Sequence != SequenceFinal {
+			return true
+		}
+	}
+	return false
+}
+
 func (tx *Transaction) IsCoinbase() bool {
 	// This checks a transaction and will only return true if it is a newly minted "coin"
 	return len(tx.Inputs) == 1 && len(tx.Inputs[0].ID) == 0 && tx.Inputs[0].Out == -1
 }
 
+// Check runs the rules that a transaction must follow on its own, without
+// looking at the chain.
+func (tx *Transaction) Check() error {
+	if len(tx.Inputs) == 0 {
+		return errors.New("transaction has no inputs")
+	}
+	if len(tx.Outputs) == 0 {
+		return errors.New("transaction has no outputs")
+	}
+
+	spent := make(map[string]bool)
+	for _, in := range tx.Inputs {
+		outpoint := fmt.Sprintf("%x:%d", in.ID, in.Out)
+		if spent[outpoint] {
+			return fmt.Errorf("transaction spends %s twice", outpoint)
+		}
+		spent[outpoint] = true
+	}
+
+	if _, err := tx.OutputValue(); err != nil {
+		return err
+	}
+
+	for outId, out := range tx.Outputs {
+		if !out.IsData() {
+			continue
+		}
+		if out.Value != 0 || out.PubKeyHash != nil {
+			return fmt.Errorf("data output %d must not carry value or a key", outId)
+		}
+		if len(out.Data) > MaxDataSize {
+			return fmt.Errorf("data output %d is larger than %d bytes", outId, MaxDataSize)
+		}
+	}
+	return nil
+}
+
+// OutputValue sums the outputs of the transaction, failing if any of them is
+// negative or the total goes over MaxMoney.
+func (tx *Transaction) OutputValue() (Amount, error) {
+	var values []Amount
+	for _, out := range tx.Outputs {
+		values = append(values, out.Value)
+	}
+	return SumAmounts(values...)
+}
+
 // Find Spendable Outputs
 // Check if we have enough money to send the amount that we are asking
 // If we do, make inputs that point to the outputs we are spending
 // If there is any leftover money, make new outputs from the difference.
 // Initialize a new transaction with all the new inputs and outputs we made
 // Set a new ID, and return it.
-func NewTransaction(w *wallet.Wallet, to string, amount int, UTXO *UTXOSet) *Transaction {
-	var inputs []TxInput
-	var outputs []TxOutput
+func NewTransaction(w *wallet.Wallet, to string, amount Amount, UTXO *UTXOSet) *Transaction {
+	tx, err := NewTxBuilder(w, UTXO).Build([]TxOutput{*NewTXOutput(amount, to)})
+	if err != nil {
+		log.Panicf("Error: %s", err)
+	}
+	return tx
+}
+
+// NewDataTransaction anchors data in the chain. Since every transaction
+// needs an input, it spends one of the wallet's outputs back to itself
+// alongside the data output.
+func NewDataTransaction(w *wallet.Wallet, data []byte, UTXO *UTXOSet) (*Transaction, error) {
+	out, err := NewDataOutput(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewTxBuilder(w, UTXO).Build([]TxOutput{*out})
+}
 
-	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
-	acc, validOutputs := UTXO.FindSpendableOutputs(pubKeyHash, amount)
+// TxBuilder funds and signs transactions from the outputs of a wallet.
+type TxBuilder struct {
+	Wallet *wallet.Wallet
 
-	if acc < amount {
-		log.Panic("Error: Not enough funds!")
+	// PubKeyHash funds transactions when there is no Wallet, such as for a
+	// watch-only address. They can only be built unsigned then.
+	PubKeyHash []byte
+
+	// ChangeAddress receives the change. Change goes back to the address
+	// that paid when it is empty.
+	ChangeAddress string
+
+	UTXO     *UTXOSet
+	Selector CoinSelector
+	FeeRate  FeeRate
+
+	// Pending, when set, keeps the outputs spent by the wallet's pending
+	// transactions from being spent again. With SpendUnconfirmed the
+	// outputs those transactions pay to the wallet can be spent as well.
+	Pending          *PendingTxs
+	SpendUnconfirmed bool
+
+	// Replaceable signals replace-by-fee on the inputs, so that the fee can
+	// be bumped later with a replacement.
+	Replaceable bool
+}
+
+func NewTxBuilder(w *wallet.Wallet, UTXO *UTXOSet) *TxBuilder {
+	return &TxBuilder{w, nil, "", UTXO, DefaultCoinSelector, DefaultFeeRate, nil, false, false}
+}
+
+// NewFundingTxBuilder funds unsigned transactions from the outputs locked
+// to pubKeyHash, to be signed elsewhere.
+func NewFundingTxBuilder(pubKeyHash []byte, UTXO *UTXOSet) *TxBuilder {
+	return &TxBuilder{nil, pubKeyHash, "", UTXO, DefaultCoinSelector, DefaultFeeRate, nil, false, false}
+}
+
+func (b *TxBuilder) pubKeyHash() []byte {
+	if b.Wallet != nil {
+		return wallet.PublicKeyHash(b.Wallet.PublicKey)
 	}
-	for txid, outs := range validOutputs {
-		txID, err := hex.DecodeString(txid)
-		Handle(err)
+	return b.PubKeyHash
+}
 
-		for _, out := range outs {
-			input := TxInput{txID, out, nil, w.PublicKey}
-			inputs = append(inputs, input)
+// Build selects the coins that pay for outputs and the fee, adds a change
+// output back to the wallet when the leftover is worth it, and signs.
+func (b *TxBuilder) Build(outputs []TxOutput) (*Transaction, error) {
+	if b.Wallet == nil {
+		return nil, errors.New("transaction builder has no wallet to sign with")
+	}
+	tx, err := b.Fund(outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.sign(tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// sign signs every input of tx with the wallet. The spent outputs may be in
+// the chain or in the wallet's pending transactions.
+func (b *TxBuilder) sign(tx *Transaction) error {
+	prevTXs := make(map[string]Transaction)
+	for i, in := range tx.Inputs {
+		tx.Inputs[i].PubKey = b.Wallet.PublicKey
+
+		id := hex.EncodeToString(in.ID)
+		if pending, ok := b.Pending.lookup(id); ok {
+			prevTXs[id] = pending.Tx
+			continue
+		}
+		prevTx, err := b.UTXO.Blockchain.FindTransactions(in.ID)
+		if err != nil {
+			return err
 		}
+		prevTXs[id] = prevTx
+	}
+	tx.ID = tx.Hash()
+	tx.Sign(b.Wallet, prevTXs)
+
+	return nil
+}
+
+// spendableOutputs lists the coins the builder may fund a transaction with.
+func (b *TxBuilder) spendableOutputs(pubKeyHash []byte) []SpendableOutput {
+	coins := b.UTXO.FindSpendableOutputs(pubKeyHash)
+	if b.Pending == nil {
+		return coins
+	}
+	coins = b.Pending.Unlocked(coins)
+	if b.SpendUnconfirmed {
+		coins = append(coins, b.Pending.Outputs(pubKeyHash)...)
+	}
+	return coins
+}
+
+// Fund selects the coins that pay for outputs and the fee and adds a change
+// output when the leftover is worth it, leaving the inputs unsigned.
+func (b *TxBuilder) Fund(outputs []TxOutput) (*Transaction, error) {
+	txCopy := Transaction{nil, nil, outputs}
+	amount, err := txCopy.OutputValue()
+	if err != nil {
+		return nil, err
 	}
 
-	from := fmt.Sprintf("%s", w.Address())
+	pubKeyHash := b.pubKeyHash()
+	target := SelectionTarget{amount, outputsSize(outputs), b.FeeRate}
+	selection, err := SelectCoins(b.Selector, b.spendableOutputs(pubKeyHash), target)
+	if err != nil {
+		return nil, err
+	}
+
+	// Inputs are added in a fixed order so that signing is reproducible.
+	coins := selection.Coins
+	sort.Slice(coins, func(i, j int) bool {
+		if c := bytes.Compare(coins[i].TxID, coins[j].TxID); c != 0 {
+			return c < 0
+		}
+		return coins[i].Out < coins[j].Out
+	})
+
+	sequence := SequenceFinal
+	if b.Replaceable {
+		sequence = SequenceReplaceable
+	}
 
-	outputs = append(outputs, *NewTXOutput(amount, to))
+	var inputs []TxInput
+	for _, coin := range coins {
+		inputs = append(inputs, TxInput{coin.TxID, coin.Out, nil, nil, sequence})
+	}
 
-	if acc > amount {
-		outputs = append(outputs, *NewTXOutput(acc-amount, from))
+	outputs = append([]TxOutput{}, outputs...)
+	if selection.Change > 0 && b.ChangeAddress != "" {
+		outputs = append(outputs, *NewTXOutput(selection.Change, b.ChangeAddress))
+	} else if selection.Change > 0 {
+		outputs = append(outputs, TxOutput{selection.Change, pubKeyHash, nil})
 	}
 
 	tx := Transaction{nil, inputs, outputs}
 	tx.ID = tx.Hash()
-	UTXO.Blockchain.SignTransaction(&tx, w.PrivateKey)
 
-	return &tx
+	return &tx, nil
 }
 
 func (tx *Transaction) TrimmedCopy() Transaction {
@@ -161,7 +366,7 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 	var outputs []TxOutput
 
 	for _, in := range tx.Inputs {
-		inputs = append(inputs, TxInput{in.ID, in.Out, nil, nil})
+		inputs = append(inputs, TxInput{in.ID, in.Out, nil, nil, in.Sequence})
 	}
 
 	outputs = append(outputs, tx.Outputs...)
@@ -171,7 +376,7 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 
 }
 
-func (tx *Transaction) Sign(privateKey ecdsa.PrivateKey, previousTXs map[string]Transaction) {
+func (tx *Transaction) Sign(w *wallet.Wallet, previousTXs map[string]Transaction) {
 	if tx.IsCoinbase() {
 		return
 	}
@@ -182,21 +387,29 @@ func (tx *Transaction) Sign(privateKey ecdsa.PrivateKey, previousTXs map[string]
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
-
-	for inId, in := range txCopy.Inputs {
+	for inId, in := range tx.Inputs {
 		prevTx := previousTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = prevTx.Outputs[in.Out].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inId].PubKey = nil
-
-		r, s, err := ecdsa.Sign(rand.Reader, &privateKey, txCopy.ID)
+		err := tx.SignInput(inId, w, prevTx.Outputs[in.Out].PubKeyHash, SigHashAll)
 		Handle(err)
-		signature := append(r.Bytes(), s.Bytes()...)
+	}
+}
+
+// SignInput signs a single input, committing to the parts of the transaction
+// selected by hashType. prevPubKeyHash locks the output the input spends.
+func (tx *Transaction) SignInput(inId int, w *wallet.Wallet, prevPubKeyHash []byte, hashType SigHashType) error {
+	hash, err := tx.SigHash(inId, prevPubKeyHash, hashType)
+	if err != nil {
+		return err
+	}
 
-		tx.Inputs[inId].Signature = signature
+	signature, err := w.Sign(hash)
+	if err != nil {
+		return err
 	}
+
+	// The hash type travels as the last byte of the signature.
+	tx.Inputs[inId].Signature = append(signature, byte(hashType))
+	return nil
 }
 
 func (tx *Transaction) Verify(prevTxs map[string]Transaction) bool {
@@ -204,42 +417,47 @@ func (tx *Transaction) Verify(prevTxs map[string]Transaction) bool {
 		return true
 	}
 
+	checks, ok := tx.sigChecks(prevTxs)
+	return ok && verifySigChecks(checks)
+}
+
+// sigChecks collects the signature of every input together with the digest
+// it must sign, so they can be verified in parallel. It fails straight away
+// on inputs that can never be valid.
+func (tx *Transaction) sigChecks(prevTxs map[string]Transaction) ([]sigCheck, bool) {
+	var checks []sigCheck
+
 	for _, in := range tx.Inputs {
 		if prevTxs[hex.EncodeToString(in.ID)].ID == nil {
 			log.Panic("Error: Previous transaction does not exist")
 		}
-	}
-
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
-
-	for inId, in := range txCopy.Inputs {
 		prevTx := prevTxs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = prevTx.Outputs[in.Out].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inId].PubKey = nil
-
-		r := big.Int{}
-		s := big.Int{}
-		// first half of the signature is r and the second half is s
-		sigLen := len(in.Signature)
-		r.SetBytes(in.Signature[:(sigLen / 2)])
-		s.SetBytes(in.Signature[(sigLen / 2):])
+		if in.Out < 0 || in.Out >= len(prevTx.Outputs) || prevTx.Outputs[in.Out].IsData() {
+			return nil, false
+		}
+	}
 
-		x := big.Int{}
-		y := big.Int{}
+	for inId, in := range tx.Inputs {
+		prevOut := prevTxs[hex.EncodeToString(in.ID)].Outputs[in.Out]
 
-		pubLen := len(in.PubKey)
-		x.SetBytes(in.PubKey[:(pubLen / 2)])
-		y.SetBytes(in.PubKey[(pubLen / 2):])
+		// The key must be the one the spent output is locked to.
+		if !in.UsesKey(prevOut.PubKeyHash) {
+			return nil, false
+		}
 
-		rawPublicKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
+		if len(in.Signature) != wallet.SignatureLength+1 {
+			return nil, false
+		}
+		hashType := SigHashType(in.Signature[len(in.Signature)-1])
+		signature := in.Signature[:len(in.Signature)-1]
 
-		if !ecdsa.Verify(&rawPublicKey, txCopy.ID, &r, &s) {
-			return false
+		hash, err := tx.SigHash(inId, prevOut.PubKeyHash, hashType)
+		if err != nil {
+			return nil, false
 		}
+
+		checks = append(checks, sigCheck{hash, in.PubKey, signature})
 	}
 
-	return true
+	return checks, true
 }
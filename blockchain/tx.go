@@ -3,19 +3,36 @@ package blockchain
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
 
 	"github.com/TualatinX/blockchain-go/wallet"
 )
 
 type TxOutput struct {
 	// Value would be representative of the amount of coins in a transaction
-	Value int
+	Value Amount
 
 	PubKeyHash []byte
+
+	// Data carries arbitrary bytes in a provably unspendable output.
+	// Data outputs hold no value and are never added to the UTXO set.
+	Data []byte
 }
 
+// MaxDataSize is the largest payload a single data output may carry.
+const MaxDataSize = 80
+
 type TxOutputs struct {
 	Outputs []TxOutput
+
+	// Indexes holds the position of each output in its transaction, since
+	// spent and data outputs are left out of the UTXO set.
+	Indexes []int
+
+	// Height of the block holding the transaction and whether it is a
+	// coinbase, which decide when the outputs mature.
+	Height   int
+	Coinbase bool
 }
 
 //TxInput is representative of a reference to a previous TxOutput
@@ -29,14 +46,37 @@ type TxInput struct {
 
 	Signature []byte
 	PubKey    []byte
+
+	// Sequence opts the transaction in to replace-by-fee when it is not
+	// SequenceFinal: until it confirms, a conflicting transaction paying a
+	// higher fee may take its place in the memory pool.
+	Sequence uint32
 }
 
-func NewTXOutput(value int, address string) *TxOutput {
-	txo := &TxOutput{value, nil}
+// SequenceFinal is the sequence of inputs that can not be replaced, and
+// SequenceReplaceable the one wallets use to signal replace-by-fee.
+const (
+	SequenceFinal       uint32 = 0
+	SequenceReplaceable uint32 = 1
+)
+
+func NewTXOutput(value Amount, address string) *TxOutput {
+	txo := &TxOutput{value, nil, nil}
 	txo.Lock([]byte(address))
 	return txo
 }
 
+func NewDataOutput(data []byte) (*TxOutput, error) {
+	if len(data) == 0 || len(data) > MaxDataSize {
+		return nil, fmt.Errorf("data output must carry between 1 and %d bytes", MaxDataSize)
+	}
+	return &TxOutput{0, nil, data}, nil
+}
+
+func (out *TxOutput) IsData() bool {
+	return len(out.Data) > 0
+}
+
 func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
 	lockingHash := wallet.PublicKeyHash(in.PubKey)
 	return bytes.Equal(lockingHash, pubKeyHash)
@@ -52,6 +92,11 @@ func (out *TxOutput) IsLockedWithKey(pubKeyHash []byte) bool {
 
 }
 
+// IsMature reports whether the outputs can be spent in a block at height.
+func (outs *TxOutputs) IsMature(height int) bool {
+	return !outs.Coinbase || height-outs.Height >= CoinbaseMaturity
+}
+
 func (outs *TxOutputs) Serialize() []byte {
 	var content bytes.Buffer
 
@@ -94,7 +94,6 @@ func (u *UTXOSet) Update(block *Block) {
 		for _, tx := range block.Transactions {
 			if !tx.IsCoinbase() {
 				for _, in := range tx.Inputs {
-					updatedOuts := TxOutputs{}
 					inID := append(utxoPrefix, in.ID...)
 					item, err := txn.Get(inID)
 					Handle(err)
@@ -107,10 +106,12 @@ func (u *UTXOSet) Update(block *Block) {
 					Handle(err)
 
 					outs := DeserializeOutputs(v)
+					updatedOuts := TxOutputs{Height: outs.Height, Coinbase: outs.Coinbase}
 
-					for outIdx, out := range outs.Outputs {
-						if outIdx != in.Out {
+					for i, out := range outs.Outputs {
+						if outs.Indexes[i] != in.Out {
 							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
+							updatedOuts.Indexes = append(updatedOuts.Indexes, outs.Indexes[i])
 						}
 					}
 
@@ -127,8 +128,16 @@ func (u *UTXOSet) Update(block *Block) {
 				}
 			}
 
-			newOutputs := TxOutputs{}
-			newOutputs.Outputs = append(newOutputs.Outputs, tx.Outputs...)
+			newOutputs := TxOutputs{Height: block.Height, Coinbase: tx.IsCoinbase()}
+			for outIdx, out := range tx.Outputs {
+				if !out.IsData() {
+					newOutputs.Outputs = append(newOutputs.Outputs, out)
+					newOutputs.Indexes = append(newOutputs.Indexes, outIdx)
+				}
+			}
+			if len(newOutputs.Outputs) == 0 {
+				continue
+			}
 
 			txID := append(utxoPrefix, tx.ID...)
 			if err := txn.Set(txID, newOutputs.Serialize()); err != nil {
@@ -192,9 +201,11 @@ func (u *UTXOSet) FindUnspentTransactions(pubKeyHash []byte) []TxOutput {
 	return UTXOs
 }
 
-func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
-	unspentOuts := make(map[string][]int)
-	accumulated := 0
+// GetBalance sums the unspent outputs locked to pubKeyHash, keeping coinbase
+// outputs that cannot be spent in the next block apart as immature.
+func (u *UTXOSet) GetBalance(pubKeyHash []byte) (Amount, Amount) {
+	var balance, immature Amount
+	height := u.Blockchain.GetBestHeight() + 1
 
 	db := u.Blockchain.Database
 
@@ -203,8 +214,45 @@ func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[s
 		defer iterator.Close()
 		for iterator.Seek(utxoPrefix); iterator.ValidForPrefix(utxoPrefix); iterator.Next() {
 			var outputs TxOutputs
+			err := iterator.Item().Value(func(val []byte) error {
+				outputs = DeserializeOutputs(val)
+				return nil
+			})
+			Handle(err)
+
+			for _, out := range outputs.Outputs {
+				if !out.IsLockedWithKey(pubKeyHash) {
+					continue
+				}
+				if outputs.IsMature(height) {
+					balance += out.Value
+				} else {
+					immature += out.Value
+				}
+			}
+		}
+		return nil
+	})
+	Handle(err)
 
-			txID := hex.EncodeToString(bytes.TrimPrefix(iterator.Item().Key(), utxoPrefix))
+	return balance, immature
+}
+
+// FindSpendableOutputs returns the outputs locked to pubKeyHash that can be
+// spent in the next block.
+func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte) []SpendableOutput {
+	var coins []SpendableOutput
+	height := u.Blockchain.GetBestHeight() + 1
+
+	db := u.Blockchain.Database
+
+	err := db.View(func(txn *badger.Txn) error {
+		iterator := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iterator.Close()
+		for iterator.Seek(utxoPrefix); iterator.ValidForPrefix(utxoPrefix); iterator.Next() {
+			var outputs TxOutputs
+
+			txID := bytes.TrimPrefix(iterator.Item().KeyCopy(nil), utxoPrefix)
 
 			err := iterator.Item().Value(func(val []byte) error {
 				outputs = DeserializeOutputs(val)
@@ -213,16 +261,14 @@ func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[s
 
 			Handle(err)
 
-			for outID, out := range outputs.Outputs {
-				if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-					accumulated += out.Value
-					unspentOuts[txID] = append(unspentOuts[txID], outID)
+			if !outputs.IsMature(height) {
+				continue
+			}
 
-					if accumulated >= out.Value {
-						break
-					}
+			for i, out := range outputs.Outputs {
+				if out.IsLockedWithKey(pubKeyHash) {
+					coins = append(coins, SpendableOutput{txID, outputs.Indexes[i], out.Value})
 				}
-
 			}
 
 		}
@@ -231,6 +277,30 @@ func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[s
 	})
 	Handle(err)
 
-	return accumulated, unspentOuts
+	return coins
+}
+
+// IsUnspent tells whether output out of transaction txID is in the set.
+func (u UTXOSet) IsUnspent(txID []byte, out int) bool {
+	unspent := false
+
+	err := u.Blockchain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(append(utxoPrefix, txID...))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		Handle(err)
+
+		return item.Value(func(val []byte) error {
+			for _, index := range DeserializeOutputs(val).Indexes {
+				if index == out {
+					unspent = true
+				}
+			}
+			return nil
+		})
+	})
+	Handle(err)
 
+	return unspent
 }
@@ -0,0 +1,240 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// medianTimeSpan is the number of blocks whose timestamps make up the median
+// time past.
+const medianTimeSpan = 11
+
+// MaxFutureBlockTime is how far ahead of network-adjusted time a block's
+// timestamp may be.
+var MaxFutureBlockTime = 2 * time.Hour
+
+// ValidateBlock checks a block against the chain it extends before it is
+// stored. The block's parent must already be in the database.
+func (chain *BlockChain) ValidateBlock(block *Block) error {
+	if !bytes.Equal(block.Header().Hash(), block.Hash) {
+		return errors.New("block hash does not match its header")
+	}
+	if !NewProofOfWork(block).Validate() {
+		return errors.New("block fails proof of work")
+	}
+
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return errors.New("block does not start with a coinbase transaction")
+	}
+
+	parent, err := chain.GetBlock(block.PrevHash)
+	if err != nil {
+		return errors.New("parent block is not known")
+	}
+	if block.Height != parent.Height+1 {
+		return fmt.Errorf("block height %d does not follow parent height %d", block.Height, parent.Height)
+	}
+	// Once a chain has a block committing to its timestamp, every block
+	// after it has to as well.
+	if block.Version < parent.Version || block.Version > BlockVersion {
+		return fmt.Errorf("block version %d can not follow parent version %d", block.Version, parent.Version)
+	}
+
+	if mtp := chain.MedianTimePast(block.PrevHash); block.Timestamp <= mtp {
+		return fmt.Errorf("block time %d is not after the median time past %d", block.Timestamp, mtp)
+	}
+	if limit := AdjustedTime() + int64(MaxFutureBlockTime/time.Second); block.Timestamp > limit {
+		return fmt.Errorf("block time %d is too far in the future", block.Timestamp)
+	}
+
+	fees := []Amount{reward}
+	var checks []sigCheck
+	spent := make(map[string]bool)
+	earlier := make(map[string]*Transaction)
+	for _, tx := range block.Transactions[1:] {
+		if tx.IsCoinbase() {
+			return errors.New("block has more than one coinbase transaction")
+		}
+		for _, in := range tx.Inputs {
+			outpoint := fmt.Sprintf("%x:%d", in.ID, in.Out)
+			if spent[outpoint] {
+				return fmt.Errorf("block spends %s twice", outpoint)
+			}
+			spent[outpoint] = true
+		}
+		fee, txChecks, err := chain.validateTransaction(tx, block.PrevHash, block.Height, earlier)
+		if err != nil {
+			return fmt.Errorf("transaction %x: %s", tx.ID, err)
+		}
+		fees = append(fees, fee)
+		checks = append(checks, txChecks...)
+		earlier[hex.EncodeToString(tx.ID)] = tx
+	}
+
+	coinbase := block.Transactions[0]
+	if err := coinbase.Check(); err != nil {
+		return fmt.Errorf("coinbase: %s", err)
+	}
+	allowed, err := SumAmounts(fees...)
+	if err != nil {
+		return fmt.Errorf("block fees: %s", err)
+	}
+	claimed, _ := coinbase.OutputValue()
+	if claimed > allowed {
+		return fmt.Errorf("coinbase claims %s but only %s is allowed", claimed, allowed)
+	}
+
+	// Signatures are checked last, all at once, since they are the costly
+	// part and every cheaper rule has passed by now.
+	if !verifySigChecks(checks) {
+		return errors.New("block has a transaction with an invalid signature")
+	}
+	return nil
+}
+
+// ValidateTransaction checks that tx could be included in a block at height
+// on top of the current tip. Coinbase transactions are only checked as part
+// of a block.
+func (chain *BlockChain) ValidateTransaction(tx *Transaction, height int) error {
+	return chain.ValidateTransactionWith(tx, height, nil)
+}
+
+// ValidateTransactionWith is ValidateTransaction for a transaction that may
+// spend outputs of the unconfirmed transactions, keyed by hex ID, that would
+// come before it in the same block.
+func (chain *BlockChain) ValidateTransactionWith(tx *Transaction, height int, unconfirmed map[string]*Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	_, checks, err := chain.validateTransaction(tx, chain.LastHash, height, unconfirmed)
+	if err != nil {
+		return err
+	}
+	if !verifySigChecks(checks) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// validateTransaction looks up the outputs spent by tx in the chain ending
+// at tip, or else among the unconfirmed transactions that come before it in
+// the block, makes sure none of them was spent already and checks the
+// amounts and coinbase maturity of every input. It returns the fee left
+// over by the transaction and the signatures still to be verified, so a
+// caller can verify those of many transactions together.
+func (chain *BlockChain) validateTransaction(tx *Transaction, tip []byte, height int, unconfirmed map[string]*Transaction) (Amount, []sigCheck, error) {
+	if err := tx.Check(); err != nil {
+		return 0, nil, err
+	}
+
+	prevTXs := make(map[string]Transaction)
+	var inputValues []Amount
+
+	for _, in := range tx.Inputs {
+		if spender := spentBy(in, unconfirmed); spender != nil && !bytes.Equal(spender.ID, tx.ID) {
+			return 0, nil, fmt.Errorf("input spends %x:%d, which %x spends already", in.ID, in.Out, spender.ID)
+		}
+
+		prevTX, prevHeight, err := chain.findUnspent(tip, in)
+		if parent, ok := unconfirmed[hex.EncodeToString(in.ID)]; err == errTxNotFound && ok {
+			prevTX, prevHeight, err = *parent, height, nil
+		}
+		if err == errTxNotFound {
+			return 0, nil, fmt.Errorf("input spends unknown transaction %x", in.ID)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if in.Out < 0 || in.Out >= len(prevTX.Outputs) || prevTX.Outputs[in.Out].IsData() {
+			return 0, nil, fmt.Errorf("input spends missing output %x:%d", in.ID, in.Out)
+		}
+		if prevTX.IsCoinbase() && height-prevHeight < CoinbaseMaturity {
+			return 0, nil, fmt.Errorf("input spends coinbase %x before it matures at height %d", in.ID, prevHeight+CoinbaseMaturity)
+		}
+		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+		inputValues = append(inputValues, prevTX.Outputs[in.Out].Value)
+	}
+
+	inputValue, err := SumAmounts(inputValues...)
+	if err != nil {
+		return 0, nil, fmt.Errorf("inputs: %s", err)
+	}
+	outputValue, err := tx.OutputValue()
+	if err != nil {
+		return 0, nil, fmt.Errorf("outputs: %s", err)
+	}
+	if outputValue > inputValue {
+		return 0, nil, fmt.Errorf("outputs spend %s but inputs only hold %s", outputValue, inputValue)
+	}
+
+	checks, ok := tx.sigChecks(prevTXs)
+	if !ok {
+		return 0, nil, errors.New("invalid signature")
+	}
+	return inputValue - outputValue, checks, nil
+}
+
+// findUnspent walks back from the block with hash tip to the transaction
+// whose output in spends, and returns it along with the height of the block
+// holding it. It fails if a block on the way spends that output already.
+func (chain *BlockChain) findUnspent(tip []byte, in TxInput) (Transaction, int, error) {
+	iterator := BlockChainIterator{tip, chain.Database}
+	for {
+		block := iterator.Next()
+		for _, tx := range block.Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			for _, spend := range tx.Inputs {
+				if bytes.Equal(spend.ID, in.ID) && spend.Out == in.Out {
+					return Transaction{}, 0, fmt.Errorf("input spends %x:%d, which block %d spent already", in.ID, in.Out, block.Height)
+				}
+			}
+		}
+		for _, tx := range block.Transactions {
+			if bytes.Equal(tx.ID, in.ID) {
+				return *tx, block.Height, nil
+			}
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	return Transaction{}, 0, errTxNotFound
+}
+
+// spentBy returns the unconfirmed transaction that spends the same output
+// as in, if there is one.
+func spentBy(in TxInput, unconfirmed map[string]*Transaction) *Transaction {
+	for _, tx := range unconfirmed {
+		for _, spend := range tx.Inputs {
+			if bytes.Equal(spend.ID, in.ID) && spend.Out == in.Out {
+				return tx
+			}
+		}
+	}
+	return nil
+}
+
+// MedianTimePast returns the median timestamp of the block with the given
+// hash and the ancestors before it, up to medianTimeSpan blocks in total.
+func (chain *BlockChain) MedianTimePast(hash []byte) int64 {
+	var timestamps []int64
+
+	iterator := BlockChainIterator{hash, chain.Database}
+	for len(timestamps) < medianTimeSpan {
+		block := iterator.Next()
+		timestamps = append(timestamps, block.Timestamp)
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
@@ -1,15 +1,23 @@
 package cli
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"github.com/TualatinX/blockchain-go/blockchain"
 	"github.com/TualatinX/blockchain-go/network"
 	"github.com/TualatinX/blockchain-go/wallet"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"runtime"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type CommandLine struct{}
@@ -17,14 +25,52 @@ type CommandLine struct{}
 //printUsage will display what options are availble to the user
 func (cli *CommandLine) printUsage() {
 	fmt.Println("Usage: ")
-	fmt.Println("getbalance -address ADDRESS - get balance for ADDRESS")
+	fmt.Println("getbalance [-address ADDRESS] - get balance for ADDRESS, or for every address in the wallet file")
 	fmt.Println("createblockchain -address ADDRESS creates a blockchain and rewards the mining fee")
 	fmt.Println("printchain - Prints the blocks in the chain")
-	fmt.Println("send -from FROM -to TO -amount AMOUNT -mine - Send amount of coins from one address to another. Then -mine flag is set, mine off of this node")
-	fmt.Println("createwallet - Creates a new wallet")
+	fmt.Println("send -from FROM -to TO|CONTACT -amount AMOUNT [-strategy bnb|largest|smallest|random] [-feerate RATE] [-unconfirmed] [-rbf] -mine - Send amount of coins from one address to another. Then -mine flag is set, mine off of this node")
+	fmt.Println("send -from FROM -uri URI [-amount AMOUNT] [-feerate RATE] -mine - Pays a tualatin: payment request URI")
+	fmt.Println("addcontact -name NAME -address ADDRESS - Saves an address in the address book, send -to NAME pays it")
+	fmt.Println("listcontacts - Lists the address book")
+	fmt.Println("createpaymenturi -address ADDRESS [-amount AMOUNT] [-label LABEL] [-message MESSAGE] - Prints a tualatin: URI asking for a payment to ADDRESS")
+	fmt.Println("sendmany -from FROM -file PAYMENTS [-strategy STRATEGY] [-feerate RATE] [-unconfirmed] [-rbf] -mine - Pays every ADDRESS,AMOUNT line of a CSV file, or every {\"address\", \"amount\"} of a .json file, in one transaction")
+	fmt.Println("createwallet [-type p256|ed25519|schnorr] [-account N] - Creates a new wallet with a key of the given type, p256 keys are derived from the wallet seed")
+	fmt.Println("restorewallet [-mnemonic \"WORDS\"] [-gap 20] - Restores the wallet seed and the derived addresses used in the chain")
 	fmt.Println("listaddresses - Lists the addresses in the wallet file")
 	fmt.Println("reindexutxo - Rebuilds the UTXO set")
+	fmt.Println("dumpprivkey -address ADDRESS - Prints the private key of ADDRESS in a portable text format")
+	fmt.Println("vanityaddress -prefix PREFIX - Generates keys on every CPU until an address starts with PREFIX, such as 1Tua, and adds it to the wallet")
+	fmt.Println("signmessage -address ADDRESS -message MESSAGE - Signs MESSAGE with the key of ADDRESS to prove control of it")
+	fmt.Println("verifymessage -address ADDRESS -signature SIGNATURE -message MESSAGE - Checks a signature made by signmessage")
+	fmt.Println("importaddress -address ADDRESS | -pubkey HEX [-rescan=false] - Watches an address without its private key")
+	fmt.Println("importprivkey [-key KEY] [-rescan=false] - Adds a private key printed by dumpprivkey and looks up its unspent outputs")
+	fmt.Println("encryptwallet [-passphrase PASSPHRASE] - Encrypts the private keys in the wallet file")
+	fmt.Println("walletpassphrase [-passphrase PASSPHRASE] [-timeout 5m] [-foreground] - Unlocks the encrypted wallet file for the given time, keeping the master key in the memory of a background process")
+	fmt.Println("walletpassphrasechange [-old OLD] [-new NEW] - Changes the passphrase of the encrypted wallet file")
+	fmt.Println("walletlock - Locks the encrypted wallet file again")
+	fmt.Println("createinvoice -amount AMOUNT [-memo MEMO] [-expiry 24h] [-confirmations 3] - Asks for a payment to a fresh address and prints its payment URI")
+	fmt.Println("getinvoice -id ID - Shows whether an invoice is unpaid, underpaid, paid, overpaid or expired, and how confirmed its payment is")
+	fmt.Println("listinvoices - Lists the invoices with their status")
+	fmt.Println("listwallettransactions [-address ADDRESS] [-since YYYY-MM-DD] [-until YYYY-MM-DD] - Lists what the wallet sent and received with amounts, fees, confirmations and labels")
+	fmt.Println("labeltransaction -txid TXID -label LABEL [-note NOTE] - Labels a transaction of the wallet history")
+	fmt.Println("abandontransaction -txid TXID - Forgets a pending wallet transaction that will not confirm and unlocks the outputs it spends")
+	fmt.Println("bumpfee -txid TXID [-feerate RATE] [-cpfp] [-miner ADDRESS] - Replaces a stuck wallet transaction sent with -rbf by one paying more, or sends a child paying for it with -cpfp or when it can not be replaced")
+	fmt.Println("estimatefee [-blocks 6] - Prints the fee rate, in base units per byte, to pay to be confirmed within N blocks")
+	fmt.Println("verifychain [-depth N] [-workers N] - Validates the last N blocks again and prints how long it took, without and with cached signatures")
+	fmt.Println("notarize -from FROM -files FILE1,FILE2 - Anchors the hashes of the files in a new block mined on this node and writes a FILE.receipt for each")
+	fmt.Println("verifyreceipt -receipt RECEIPT [-file FILE] - Checks a notary receipt offline, optionally against the original FILE")
+	fmt.Println("createrawtransaction -inputs TXID:OUT,... -outputs ADDRESS:AMOUNT,... [-hex HEX] - Builds an unsigned transaction, optionally adding to the raw transaction HEX")
+	fmt.Println("signrawtransaction -hex HEX -address ADDRESS [-sighash ALL|NONE|SINGLE[|ANYONECANPAY]] - Signs the inputs of HEX that belong to ADDRESS")
+	fmt.Println("decoderawtransaction -hex HEX - Prints the contents of a raw transaction")
+	fmt.Println("sendrawtransaction -hex HEX [-miner ADDRESS] - Sends a raw transaction to the network, or mines it on this node rewarding ADDRESS")
+	fmt.Println("createpsbt -outputs ADDRESS:AMOUNT,... -inputs TXID:OUT,... | -from ADDRESS [-strategy STRATEGY] [-feerate RATE] - Builds a partially signed transaction, funding it from ADDRESS if no inputs are given")
+	fmt.Println("signpsbt -psbt PSBT [-address ADDRESS] [-sighash ALL] - Signs the inputs of PSBT that belong to the wallet file, without the chain")
+	fmt.Println("combinepsbt -psbts PSBT1,PSBT2 - Merges the signatures of several copies of a partially signed transaction")
+	fmt.Println("finalizepsbt -psbt PSBT - Checks the signatures of a fully signed PSBT and prints the raw transaction")
+	fmt.Println("broadcastpsbt -psbt PSBT [-miner ADDRESS] - Finalizes PSBT and sends it to the network, or mines it on this node rewarding ADDRESS")
 	println(" startnode [-miner] ADDRESS - Starts a node with ID specified in NODE_ID environment variable, -miner flag sets the node to be a miner")
+	fmt.Println("Set COINBASE_MATURITY to change how many blocks a coinbase output waits before it can be spent (default 100)")
+	fmt.Println("Set MAX_FUTURE_BLOCK_TIME to change how far ahead of network time a block may be, e.g. 30m (default 2h)")
 }
 
 // validateArgs ensures the cli was given valid input
@@ -83,78 +129,1339 @@ func (cli *CommandLine) getBalance(address, nodeID string) {
 	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
 	defer chain.Database.Close()
 
-	balance := 0
 	pubKeyHash := wallet.Base58Decode([]byte(address))
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-wallet.ChecksumLength]
-	UTXOs := UTXOSet.FindUnspentTransactions(pubKeyHash)
+	balance, immature := UTXOSet.GetBalance(pubKeyHash)
 
-	for _, out := range UTXOs {
-		balance += out.Value
+	pending := blockchain.LoadPendingTxs(nodeID)
+	pending.Sync(UTXOSet)
+	locked, incoming := pending.Balances(UTXOSet, pubKeyHash)
+
+	fmt.Printf("Balance of %s: %s\n", address, balance-locked)
+	fmt.Printf("Pending: %s\n", incoming)
+	fmt.Printf("Locked: %s\n", locked)
+	fmt.Printf("Immature: %s\n", immature)
+}
+
+// send pays amount to to, an address or the name of a contact. A payment
+// asked for by a payment URI is labeled in the wallet history with the
+// label and message of request
+func (cli *CommandLine) send(from, to string, amount blockchain.Amount, request *blockchain.PaymentURI, strategy string, feeRate blockchain.FeeRate, unconfirmed, replaceable bool, nodeID string, mineNow bool) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	address, err := wallets.ResolveAddress(to)
+	if err != nil {
+		log.Panic(err)
+	}
+	if address != to {
+		fmt.Printf("Paying %s at %s\n", to, address)
+	}
+
+	tx := cli.pay(from, address, []blockchain.TxOutput{*blockchain.NewTXOutput(amount, address)}, strategy, feeRate, unconfirmed, replaceable, nodeID, mineNow)
+
+	if request != nil && (request.Label != "" || request.Message != "") {
+		wallets, err = wallet.CreateWallets(nodeID)
+		if err != nil {
+			log.Panic(err)
+		}
+		wallets.LabelTx(tx.ID, request.Label, request.Message)
+		wallets.SaveHistory(nodeID)
+	}
+}
+
+// sendMany pays every recipient listed in a CSV or JSON file with a single
+// transaction
+func (cli *CommandLine) sendMany(from, file, strategy string, feeRate blockchain.FeeRate, unconfirmed, replaceable bool, nodeID string, mineNow bool) {
+	payments, err := blockchain.LoadPayments(file)
+	if err != nil {
+		log.Panic(err)
+	}
+	outputs, err := blockchain.PaymentOutputs(payments)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	var amounts []blockchain.Amount
+	for _, p := range payments {
+		amounts = append(amounts, p.Amount)
+	}
+	total, err := blockchain.SumAmounts(amounts...)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Paying %d recipients %s in total\n", len(payments), total)
+
+	// A payment to several recipients has no single counterparty.
+	payee := ""
+	if len(payments) == 1 {
+		payee = payments[0].Address
+	}
+	cli.pay(from, payee, outputs, strategy, feeRate, unconfirmed, replaceable, nodeID, mineNow)
+}
+
+// pay funds outputs from the wallet of from and sends the transaction to
+// the network, or mines it right away. A zero feeRate pays the estimated
+// rate. Outputs spent by pending transactions of the wallet are left alone,
+// and the outputs those pay to from are only spent if unconfirmed is set.
+// A replaceable transaction can have its fee bumped with bumpfee. The
+// wallet history lists the transaction as a payment to payee, unless it is
+// empty
+func (cli *CommandLine) pay(from, payee string, outputs []blockchain.TxOutput, strategy string, feeRate blockchain.FeeRate, unconfirmed, replaceable bool, nodeID string, mineNow bool) *blockchain.Transaction {
+	if !wallet.ValidateAddress(from) {
+		log.Panic("Address is not Valid")
+	}
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	w, err := wallets.SigningWallet(from)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	pending := blockchain.LoadPendingTxs(nodeID)
+	pending.Sync(UTXOSet)
+
+	builder := blockchain.NewTxBuilder(w, &UTXOSet)
+	builder.Pending = pending
+	builder.SpendUnconfirmed = unconfirmed
+	builder.Replaceable = replaceable
+	if feeRate == 0 {
+		feeRate = chain.EstimateFee(nodeID, blockchain.DefaultConfirmTarget)
+		fmt.Printf("Estimated fee rate: %d per byte\n", feeRate)
+	}
+	builder.FeeRate = feeRate
+	if strategy != "" {
+		builder.Selector, err = blockchain.ParseCoinSelector(strategy)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	builder.ChangeAddress, err = wallets.NewChangeAddress(w)
+	if err != nil {
+		log.Panic(err)
+	}
+	tx, err := builder.Build(outputs)
+	if err != nil {
+		log.Panic(err)
+	}
+	// The change address is only kept if the transaction pays to it.
+	if len(tx.Outputs) > len(outputs) {
+		wallets.SaveFile(nodeID)
+		fmt.Printf("Change sent to %s\n", builder.ChangeAddress)
+	}
+	fee, err := chain.TransactionFeeWith(tx, pending.Unconfirmed())
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Spending %d outputs, fee %s\n", len(tx.Inputs), fee)
+
+	if mineNow {
+		// Pending transactions whose outputs are spent go in the same block.
+		cbTx := blockchain.CoinbaseTx(from, "")
+		txs := append([]*blockchain.Transaction{cbTx}, pending.Ancestors(tx)...)
+		txs = append(txs, tx)
+		block := chain.MineBlock(txs)
+		UTXOSet.Update(block)
+		pending.Sync(UTXOSet)
+	} else {
+		pending.Add(tx, true)
+		network.SendTx(network.KnownNodes[0], tx)
+		fmt.Println("send tx")
+	}
+	pending.SaveFile(nodeID)
+
+	// The history keeps who was paid, which the outputs do not tell. It is
+	// read again in case the node scanned a block in the meantime.
+	if payee != "" {
+		wallets, err = wallet.CreateWallets(nodeID)
+		if err != nil {
+			log.Panic(err)
+		}
+		wallets.SetCounterparty(tx.ID, payee)
+		wallets.SaveHistory(nodeID)
+	}
+
+	fmt.Printf("Success! Transaction %x\n", tx.ID)
+	return tx
+}
+
+// estimateFee prints the fee rate that gets a transaction confirmed within
+// the given number of blocks
+func (cli *CommandLine) estimateFee(blocks int, nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	fmt.Printf("%d per byte\n", chain.EstimateFee(nodeID, blocks))
+}
+
+// getWalletBalance prints the balance of every address in the wallet file,
+// keeping watch-only addresses out of the spendable total
+func (cli *CommandLine) getWalletBalance(nodeID string) {
+	wallets := loadWallets(nodeID)
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	pending := blockchain.LoadPendingTxs(nodeID)
+	pending.Sync(UTXOSet)
+
+	var total, incoming, locked, watched blockchain.Amount
+	for _, address := range wallets.GetAllAddresses() {
+		pubKeyHash, err := wallet.PubKeyHashOf(address)
+		if err != nil {
+			log.Panic(err)
+		}
+		balance, immature := UTXOSet.GetBalance(pubKeyHash)
+		addressLocked, addressIncoming := pending.Balances(UTXOSet, pubKeyHash)
+		balance -= addressLocked
+
+		if wallets.IsWatchOnly(address) {
+			watched += balance
+			fmt.Printf("%s: %s (immature %s, watch-only)\n", address, balance, immature)
+			continue
+		}
+
+		total += balance
+		incoming += addressIncoming
+		locked += addressLocked
+		note := ""
+		if wallets.IsChange(address) {
+			note = ", change"
+		}
+		fmt.Printf("%s: %s (immature %s, pending %s, locked %s%s)\n", address, balance, immature, addressIncoming, addressLocked, note)
+	}
+
+	fmt.Printf("Balance: %s\n", total)
+	fmt.Printf("Pending: %s\n", incoming)
+	fmt.Printf("Locked: %s\n", locked)
+	fmt.Printf("Watch-only: %s\n", watched)
+}
+
+//listAddresses will list all addresses in the wallet file
+func (cli *CommandLine) listAddresses(nodeID string) {
+	wallets := loadWallets(nodeID)
+	addresses := wallets.GetAllAddresses()
+
+	var change []string
+	for _, address := range addresses {
+		if wallets.IsChange(address) {
+			change = append(change, address)
+		} else if wallets.IsWatchOnly(address) {
+			fmt.Printf("%s (watch-only)\n", address)
+		} else {
+			fmt.Println(address)
+		}
+	}
+
+	if len(change) > 0 {
+		fmt.Println("Change addresses:")
+		for _, address := range change {
+			fmt.Println(address)
+		}
+	}
+
+}
+
+// historyDate is how listwallettransactions reads and prints dates.
+const historyDate = "2006-01-02"
+
+// listWalletTransactions prints what the wallet sent and received, oldest
+// first, optionally only what involves address or happened between the
+// days since and until
+func (cli *CommandLine) listWalletTransactions(address, since, until, nodeID string) {
+	var from, to time.Time
+	var err error
+	if since != "" {
+		if from, err = time.ParseInLocation(historyDate, since, time.Local); err != nil {
+			log.Panic("Dates are written YYYY-MM-DD")
+		}
+	}
+	if until != "" {
+		if to, err = time.ParseInLocation(historyDate, until, time.Local); err != nil {
+			log.Panic("Dates are written YYYY-MM-DD")
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	pending := blockchain.LoadPendingTxs(nodeID)
+	pending.Sync(UTXOSet)
+	chain.SyncWalletHistory(wallets, pending.Unconfirmed())
+	wallets.SaveHistory(nodeID)
+
+	bestHeight := chain.GetBestHeight()
+	for _, tx := range wallets.Transactions() {
+		when := time.Unix(tx.Time, 0)
+		if address != "" && !tx.Involves(address) {
+			continue
+		}
+		if (since != "" && when.Before(from)) || (until != "" && !when.Before(to)) {
+			continue
+		}
+
+		counterparty := tx.Address
+		if counterparty == "" && tx.PubKeyHash != nil {
+			counterparty = fmt.Sprintf("public key hash %x", tx.PubKeyHash)
+		}
+		if counterparty == "" && tx.Recipients > 1 {
+			counterparty = fmt.Sprintf("%d recipients", tx.Recipients)
+		}
+		if name, ok := wallets.ContactName(tx.Address); ok {
+			counterparty += " (" + name + ")"
+		}
+		line := fmt.Sprintf("%s %s %s", when.Format("2006-01-02 15:04:05"), tx.Direction, blockchain.Amount(tx.Amount))
+		switch tx.Direction {
+		case wallet.Sent:
+			line += " to " + counterparty
+		case wallet.Self:
+			line += " to self"
+		default:
+			line += " at " + counterparty
+		}
+		if tx.Fee > 0 {
+			line += fmt.Sprintf(", fee %s", blockchain.Amount(tx.Fee))
+		}
+		if tx.IsConfirmed() {
+			line += fmt.Sprintf(", %d confirmations", tx.Confirmations(bestHeight))
+		} else {
+			line += ", unconfirmed"
+		}
+
+		fmt.Println(line)
+		fmt.Printf("\tTXID: %x\n", tx.TxID)
+		if tx.Label != "" {
+			fmt.Printf("\tLabel: %s\n", tx.Label)
+		}
+		if tx.Note != "" {
+			fmt.Printf("\tNote: %s\n", tx.Note)
+		}
+	}
+}
+
+// labelTransaction sets the label and note of a transaction in the wallet
+// history
+func (cli *CommandLine) labelTransaction(txID, label, note, nodeID string) {
+	id, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic("Transaction ID is not hex")
+	}
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	if !wallets.LabelTx(id, label, note) {
+		log.Panic("Transaction is not in the wallet history, see listwallettransactions")
+	}
+	wallets.SaveHistory(nodeID)
+
+	fmt.Println("Transaction labeled")
+}
+
+// addContact saves an address in the address book, so that it can be paid
+// by name
+func (cli *CommandLine) addContact(name, address, nodeID string) {
+	wallets := loadWallets(nodeID)
+
+	replaced, err := wallets.AddContact(name, address)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+
+	if replaced {
+		fmt.Printf("Contact %s now pays to %s\n", name, address)
+	} else {
+		fmt.Printf("Contact %s added\n", name)
+	}
+}
+
+func (cli *CommandLine) listContacts(nodeID string) {
+	wallets := loadWallets(nodeID)
+
+	for _, c := range wallets.ListContacts() {
+		fmt.Printf("%s: %s\n", c.Name, c.Address)
+	}
+}
+
+// createPaymentURI prints a payment request URI for address, to be handed
+// to the payer
+func (cli *CommandLine) createPaymentURI(address string, amount blockchain.Amount, label, message string) {
+	if !wallet.ValidateAddress(address) {
+		log.Panic("Address is not Valid")
+	}
+	request := blockchain.PaymentURI{Address: address, Amount: amount, Label: label, Message: message}
+	fmt.Println(request.String())
+}
+
+// createInvoice asks for amount to be paid to a fresh address of the
+// wallet within expiry, confirmed by the given number of blocks
+func (cli *CommandLine) createInvoice(amount blockchain.Amount, memo string, expiry time.Duration, confirmations int, nodeID string) {
+	wallets := loadWallets(nodeID)
+
+	var address string
+	var err error
+	if wallets.HasHDChain() {
+		address, err = wallets.NextAddress(0, wallet.ExternalChain)
+	} else {
+		address, err = wallets.AddWallet(wallet.P256)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	now := time.Now()
+	invoices := blockchain.LoadInvoices(nodeID)
+	inv := invoices.Add(address, amount, memo, now.Unix(), now.Add(expiry).Unix(), chain.GetBestHeight(), confirmations)
+	wallets.SaveFile(nodeID)
+	invoices.SaveFile(nodeID)
+
+	fmt.Printf("Invoice %d for %s to %s, expires %s\n", inv.ID, inv.Amount, inv.Address, time.Unix(inv.Expires, 0).Format("2006-01-02 15:04:05"))
+	fmt.Println(inv.URI())
+}
+
+// updateInvoices brings the status of the invoices up to date with the chain
+func updateInvoices(nodeID string) (*blockchain.Invoices, int) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	invoices := blockchain.LoadInvoices(nodeID)
+	if changed, settled := invoices.Update(chain, time.Now().Unix()); len(changed) > 0 || settled > 0 {
+		invoices.SaveFile(nodeID)
+	}
+	return invoices, chain.GetBestHeight()
+}
+
+func (cli *CommandLine) getInvoice(id int, nodeID string) {
+	invoices, bestHeight := updateInvoices(nodeID)
+	inv, ok := invoices.Invoices[id]
+	if !ok {
+		log.Panicf("There is no invoice %d", id)
+	}
+
+	fmt.Printf("Invoice %d: %s\n", inv.ID, inv.Describe(bestHeight))
+	fmt.Printf("Address: %s\n", inv.Address)
+	fmt.Printf("Amount: %s\n", inv.Amount)
+	fmt.Printf("Received: %s\n", inv.Received)
+	if inv.Memo != "" {
+		fmt.Printf("Memo: %s\n", inv.Memo)
+	}
+	fmt.Printf("Created: %s\n", time.Unix(inv.Created, 0).Format("2006-01-02 15:04:05"))
+	fmt.Printf("Expires: %s\n", time.Unix(inv.Expires, 0).Format("2006-01-02 15:04:05"))
+	fmt.Printf("Confirmations: %d of %d\n", inv.ConfirmationsAt(bestHeight), inv.Confirmations)
+	for _, txID := range inv.Payments {
+		fmt.Printf("Payment: %x\n", txID)
+	}
+	fmt.Printf("URI: %s\n", inv.URI())
+}
+
+func (cli *CommandLine) listInvoices(nodeID string) {
+	invoices, bestHeight := updateInvoices(nodeID)
+
+	for _, inv := range invoices.List() {
+		line := fmt.Sprintf("%d: %s, %s of %s to %s", inv.ID, inv.Describe(bestHeight), inv.Received, inv.Amount, inv.Address)
+		if inv.Memo != "" {
+			line += " - " + inv.Memo
+		}
+		fmt.Println(line)
+	}
+}
+
+//createWallet will create a wallet in the wallet file
+func (cli *CommandLine) createWallet(keyType string, account uint, nodeID string) {
+	kind, err := wallet.ParseKeyType(keyType)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallets := loadWallets(nodeID)
+
+	var address string
+	if kind == wallet.P256 {
+		// P-256 keys are derived from the wallet seed, which is created
+		// along with the first of them.
+		if !wallets.HasHDChain() {
+			mnemonic, err := wallets.NewHDChain()
+			if err != nil {
+				log.Panic(err)
+			}
+			fmt.Printf("Wallet seed: %s\n", mnemonic)
+			fmt.Println("Write these words down, restorewallet rebuilds every p256 address from them")
+		}
+		address, err = wallets.NextAddress(uint32(account), wallet.ExternalChain)
+	} else {
+		address, err = wallets.AddWallet(kind)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+
+	fmt.Printf("New address is: %s\n", address)
+
+}
+
+// restoreWallet sets the wallet seed from a mnemonic and adds the derived
+// addresses the chain has seen
+func (cli *CommandLine) restoreWallet(mnemonic string, gapLimit int, nodeID string) {
+	wallets := loadWallets(nodeID)
+	words := string(readSecret(mnemonic, "Mnemonic: "))
+
+	used := make(map[string]bool)
+	if blockchain.BlockChainExists(nodeID) {
+		chain := blockchain.ContinueBlockChain(nodeID)
+		used = chain.UsedPubKeyHashes()
+		chain.Database.Close()
+	} else {
+		fmt.Println("No blockchain found, only the seed is restored")
+	}
+
+	isUsed := func(pubKeyHash []byte) bool {
+		return used[hex.EncodeToString(pubKeyHash)]
+	}
+	restored, err := wallets.RestoreHDChain(words, isUsed, gapLimit)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+
+	fmt.Printf("Restored %d used addresses\n", restored)
+}
+
+// loadWallets reads the wallet file of the node. A missing file gives an
+// empty wallet, but any other error stops the command, so that a wallet file
+// that could not be read is never saved over.
+func loadWallets(nodeID string) *wallet.Wallets {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil && !os.IsNotExist(err) {
+		log.Panic(err)
+	}
+	return wallets
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// readSecret returns the passphrase or key given on the command line, or
+// asks for it on standard input so it stays out of the shell history.
+func readSecret(value, prompt string) []byte {
+	if value != "" {
+		return []byte(value)
+	}
+
+	fmt.Print(prompt)
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		log.Panic("Nothing was entered")
+	}
+	return []byte(strings.TrimRight(line, "\r\n"))
+}
+
+func (cli *CommandLine) encryptWallet(passphrase, nodeID string) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	if err := wallets.Encrypt(readSecret(passphrase, "Passphrase: ")); err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+
+	fmt.Println("Wallet encrypted, unlock it with walletpassphrase before sending")
+}
+
+func (cli *CommandLine) walletPassphrase(passphrase string, timeout time.Duration, foreground bool, nodeID string) {
+	secret := readSecret(passphrase, "Passphrase: ")
+	if foreground {
+		err := wallet.WalletPassphrase(nodeID, secret, timeout, func() {
+			fmt.Printf("Wallet unlocked for %s\n", timeout)
+		})
+		if err != nil {
+			log.Panic(err)
+		}
+		return
+	}
+
+	// A wrong passphrase is reported here rather than by the background
+	// process, which is given the passphrase on its standard input.
+	wallets := loadWallets(nodeID)
+	if err := wallets.Unlock(secret); err != nil {
+		log.Panic(err)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		log.Panic(err)
+	}
+	agent := exec.Command(executable, "walletpassphrase", "-timeout", timeout.String(), "-foreground")
+	agent.Stdin = bytes.NewReader(append(secret, '\n'))
+	agent.Stderr = os.Stderr
+	out, err := agent.StdoutPipe()
+	if err != nil {
+		log.Panic(err)
+	}
+	if err := agent.Start(); err != nil {
+		log.Panic(err)
+	}
+
+	// The prompt is left out of what the background process prints.
+	line, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		log.Panic("Could not unlock the wallet")
+	}
+	fmt.Print(strings.TrimPrefix(line, "Passphrase: "))
+}
+
+func (cli *CommandLine) walletPassphraseChange(oldPassphrase, newPassphrase, nodeID string) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	current := readSecret(oldPassphrase, "Old passphrase: ")
+	next := readSecret(newPassphrase, "New passphrase: ")
+	if err := wallets.ChangePassphrase(current, next); err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+
+	fmt.Println("Passphrase changed")
+}
+
+func (cli *CommandLine) walletLock(nodeID string) {
+	if err := wallet.LockWallet(nodeID); err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println("Wallet locked")
+}
+
+func (cli *CommandLine) dumpPrivKey(address, nodeID string) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	w, ok := wallets.Wallets[address]
+	if !ok {
+		log.Panic("Address is not in the wallet")
+	}
+
+	key, err := wallet.EncodePrivateKey(w)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println(key)
+}
+
+// signMessage proves control of an address without moving coins
+func (cli *CommandLine) signMessage(address, message, nodeID string) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	w, err := wallets.SigningWallet(address)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	signature, err := w.SignMessage(message)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(signature))
+}
+
+func (cli *CommandLine) verifyMessage(address, signature, message string) {
+	if !wallet.ValidateAddress(address) {
+		log.Panic("Address is not Valid")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		log.Panic("Signature is not base64")
+	}
+
+	if wallet.VerifyMessage(address, decoded, message) {
+		fmt.Println("Signature is valid")
+	} else {
+		fmt.Println("Signature is NOT valid")
+		os.Exit(1)
+	}
+}
+
+func (cli *CommandLine) importPrivKey(key string, rescan bool, nodeID string) {
+	w, err := wallet.DecodePrivateKey(string(readSecret(key, "Private key: ")))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallets := loadWallets(nodeID)
+	address, err := wallets.ImportWallet(w)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+	fmt.Printf("Imported %s key for %s\n", w.Type, address)
+
+	if rescan {
+		rescanAddress(wallet.PublicKeyHash(w.PublicKey), nodeID)
+	}
+}
+
+// vanityAddress generates keys on every CPU until one has an address
+// starting with prefix, and adds it to the wallet
+func (cli *CommandLine) vanityAddress(prefix string, nodeID string) {
+	wallets := loadWallets(nodeID)
+	if wallets.IsLocked() {
+		log.Panic(wallet.ErrWalletLocked)
+	}
+
+	workers := runtime.NumCPU()
+	difficulty := wallet.VanityDifficulty(prefix)
+	fmt.Printf("Searching for %s with %d workers, about %.0f keys to try\n", prefix, workers, difficulty)
+
+	search := &wallet.VanitySearch{Prefix: prefix}
+	found := make(chan *wallet.Wallet)
+	go func() {
+		found <- search.Run(workers)
+	}()
+
+	start := time.Now()
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	var w *wallet.Wallet
+	for w == nil {
+		select {
+		case w = <-found:
+		case <-ticker.C:
+			tried := search.Tried()
+			rate := float64(tried) / time.Since(start).Seconds()
+			fmt.Printf("Tried %d keys (%.0f per second, %.1f%% of the expected)\n", tried, rate, 100*float64(tried)/difficulty)
+		}
+	}
+
+	address, err := wallets.ImportWallet(w)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+	fmt.Printf("Found %s after %d keys in %s\n", address, search.Tried(), time.Since(start).Round(time.Second))
+}
+
+func (cli *CommandLine) importAddress(address, publicKey string, rescan bool, nodeID string) {
+	wallets := loadWallets(nodeID)
+
+	var watched *wallet.WatchOnly
+	var err error
+	if publicKey != "" {
+		key, decodeErr := hex.DecodeString(publicKey)
+		if decodeErr != nil {
+			log.Panic("Public key is not hex")
+		}
+		watched, err = wallets.WatchPublicKey(key)
+	} else {
+		watched, err = wallets.WatchAddress(address)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+	fmt.Printf("Watching %s\n", watched.Address())
+
+	if rescan {
+		rescanAddress(watched.PubKeyHash, nodeID)
+	}
+}
+
+// rescanAddress prints the unspent outputs of a newly added address. The
+// UTXO set holds the outputs of every address, so they only have to be
+// looked up.
+func rescanAddress(pubKeyHash []byte, nodeID string) {
+	if !blockchain.BlockChainExists(nodeID) {
+		return
+	}
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+
+	outputs := UTXOSet.FindUnspentTransactions(pubKeyHash)
+	balance, immature := UTXOSet.GetBalance(pubKeyHash)
+	fmt.Printf("Found %d unspent outputs: %s spendable, %s immature\n", len(outputs), balance, immature)
+}
+
+func (cli *CommandLine) reIndexUTXO(nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	UTXOSet.ReIndex()
+
+	count := UTXOSet.CountTransactions()
+	fmt.Printf("Done! There are %d UTXOs in the database\n", count)
+}
+
+// verifyChain validates the newest blocks twice: the first pass verifies every
+// signature, the second finds them in the signature cache.
+func (cli *CommandLine) verifyChain(depth, workers int, nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	if workers > 0 {
+		blockchain.SigCheckWorkers = workers
+	}
+
+	var blocks []*blockchain.Block
+	iter := chain.Iterator()
+	for depth <= 0 || len(blocks) < depth {
+		block := iter.Next()
+		if len(block.PrevHash) == 0 {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+
+	for _, pass := range []string{"cold", "cached"} {
+		var total time.Duration
+		for _, block := range blocks {
+			inputs := 0
+			for _, tx := range block.Transactions[1:] {
+				inputs += len(tx.Inputs)
+			}
+
+			start := time.Now()
+			err := chain.ValidateBlock(block)
+			elapsed := time.Since(start)
+			total += elapsed
+
+			if err != nil {
+				fmt.Printf("Block %d %x is invalid: %s\n", block.Height, block.Hash, err)
+				runtime.Goexit()
+			}
+			if pass == "cold" {
+				fmt.Printf("Block %d: %d transactions, %d inputs, %s\n", block.Height, len(block.Transactions), inputs, elapsed)
+			}
+		}
+		fmt.Printf("Validated %d blocks (%s signatures, %d workers) in %s\n", len(blocks), pass, blockchain.SigCheckWorkers, total)
+	}
+}
+
+func (cli *CommandLine) notarize(from string, files []string, nodeID string) {
+	if !wallet.ValidateAddress(from) {
+		log.Panic("Address is not Valid")
+	}
+
+	var docHashes [][]byte
+	for _, file := range files {
+		document, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Panic(err)
+		}
+		docHashes = append(docHashes, blockchain.HashDocument(document))
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	w, err := wallets.SigningWallet(from)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	tx, err := blockchain.NewDataTransaction(w, blockchain.NotaryRoot(docHashes), &UTXOSet)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	cbTx := blockchain.CoinbaseTx(from, "")
+	block := chain.MineBlock([]*blockchain.Transaction{cbTx, tx})
+	UTXOSet.Update(block)
+
+	receipts, err := blockchain.NewReceipts(docHashes, tx, block)
+	if err != nil {
+		log.Panic(err)
+	}
+	for i, receipt := range receipts {
+		if err := receipt.SaveFile(files[i] + ".receipt"); err != nil {
+			log.Panic(err)
+		}
+		fmt.Printf("Receipt for %s written to %s.receipt\n", files[i], files[i])
+	}
+
+	fmt.Printf("Notarized %d documents in block %x\n", len(files), block.Hash)
+}
+
+func (cli *CommandLine) verifyReceipt(receiptFile, file string) {
+	receipt, err := blockchain.LoadReceipt(receiptFile)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if file != "" {
+		document, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Panic(err)
+		}
+		if !bytes.Equal(blockchain.HashDocument(document), receipt.DocumentHash) {
+			fmt.Println("Receipt is not valid: the document does not match the receipt")
+			return
+		}
+	}
+
+	if err := receipt.Verify(); err != nil {
+		fmt.Printf("Receipt is not valid: %s\n", err)
+		return
+	}
+
+	fmt.Printf("Receipt is valid: document %x\n", receipt.DocumentHash)
+	fmt.Printf("Transaction: %x\n", receipt.TxID)
+	fmt.Printf("Block: %x (height %d)\n", receipt.BlockHash, receipt.Height)
+}
+
+func (cli *CommandLine) createRawTransaction(raw, inputs, outputs string) {
+	tx := &blockchain.Transaction{}
+	if raw != "" {
+		var err error
+		tx, err = blockchain.DecodeRawTransaction(raw)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	for _, input := range strings.Split(inputs, ",") {
+		if input == "" {
+			continue
+		}
+		in, err := blockchain.ParseOutpoint(input)
+		if err != nil {
+			log.Panic(err)
+		}
+		tx.Inputs = append(tx.Inputs, in)
+	}
+
+	tx.Outputs = append(tx.Outputs, parseOutputs(outputs)...)
+
+	tx.ID = tx.Hash()
+	fmt.Println(blockchain.EncodeRawTransaction(tx))
+}
+
+// parseOutputs reads comma separated payments written as ADDRESS:AMOUNT
+func parseOutputs(outputs string) []blockchain.TxOutput {
+	var txOutputs []blockchain.TxOutput
+	for _, output := range strings.Split(outputs, ",") {
+		if output == "" {
+			continue
+		}
+		sep := strings.LastIndex(output, ":")
+		if sep < 0 {
+			log.Panicf("output %q is not ADDRESS:AMOUNT", output)
+		}
+		address := output[:sep]
+		if !wallet.ValidateAddress(address) {
+			log.Panicf("Address %s is not valid", address)
+		}
+		amount, err := blockchain.ParseAmount(output[sep+1:])
+		if err != nil {
+			log.Panic(err)
+		}
+		txOutputs = append(txOutputs, *blockchain.NewTXOutput(amount, address))
+	}
+	return txOutputs
+}
+
+func (cli *CommandLine) signRawTransaction(raw, address, sigHash, nodeID string) {
+	if !wallet.ValidateAddress(address) {
+		log.Panic("Address is not Valid")
+	}
+	hashType, err := blockchain.ParseSigHashType(sigHash)
+	if err != nil {
+		log.Panic(err)
+	}
+	tx, err := blockchain.DecodeRawTransaction(raw)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	w, err := wallets.SigningWallet(address)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	signed, err := chain.SignRawTransaction(tx, w, hashType)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Signed %d of %d inputs with %s\n", signed, len(tx.Inputs), hashType)
+	fmt.Println(blockchain.EncodeRawTransaction(tx))
+}
+
+func (cli *CommandLine) decodeRawTransaction(raw string) {
+	tx, err := blockchain.DecodeRawTransaction(raw)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println(tx)
+}
+
+func (cli *CommandLine) sendRawTransaction(raw, minerAddress, nodeID string) {
+	tx, err := blockchain.DecodeRawTransaction(raw)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	cli.broadcast(tx, nil, minerAddress, nodeID)
+}
+
+// broadcast sends a signed transaction to the network, or mines it on this
+// node when minerAddress is set. replaces names the pending transaction a
+// fee bump replaces
+func (cli *CommandLine) broadcast(tx *blockchain.Transaction, replaces []byte, minerAddress, nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	pending := blockchain.LoadPendingTxs(nodeID)
+	pending.Sync(UTXOSet)
+
+	// The replaced transaction and the ones spending its outputs are
+	// dropped by the network along with it. Nothing is saved unless the
+	// replacement is valid.
+	replaced := 0
+	if replaces != nil {
+		replaced = pending.Abandon(replaces)
+	}
+	if err := chain.ValidateTransactionWith(tx, chain.GetBestHeight()+1, pending.Unconfirmed()); err != nil {
+		log.Panicf("Invalid Transaction: %s", err)
+	}
+	if replaced > 0 {
+		fmt.Printf("Replacing %d pending transactions\n", replaced)
+	}
+
+	if minerAddress != "" {
+		if !wallet.ValidateAddress(minerAddress) {
+			log.Panic("Miner address is not valid!")
+		}
+		cbTx := blockchain.CoinbaseTx(minerAddress, "")
+		txs := append([]*blockchain.Transaction{cbTx}, pending.Ancestors(tx)...)
+		block := chain.MineBlock(append(txs, tx))
+		UTXOSet.Update(block)
+		pending.Sync(UTXOSet)
+	} else {
+		pending.Add(tx, true)
+		network.SendTx(network.KnownNodes[0], tx)
+		fmt.Println("send tx")
+	}
+	pending.SaveFile(nodeID)
+
+	fmt.Printf("Success! Transaction %x\n", tx.ID)
+}
+
+// createPSBT builds an unsigned transaction to be signed with signpsbt,
+// spending the given inputs or funding the outputs from an address, which
+// may be watch-only
+func (cli *CommandLine) createPSBT(inputs, outputs, from, strategy string, feeRate blockchain.FeeRate, nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	pending := blockchain.LoadPendingTxs(nodeID)
+	pending.Sync(UTXOSet)
+
+	txOutputs := parseOutputs(outputs)
+	tx := &blockchain.Transaction{Outputs: txOutputs}
+	if inputs != "" {
+		for _, input := range strings.Split(inputs, ",") {
+			in, err := blockchain.ParseOutpoint(input)
+			if err != nil {
+				log.Panic(err)
+			}
+			tx.Inputs = append(tx.Inputs, in)
+		}
+	} else {
+		pubKeyHash, err := wallet.PubKeyHashOf(from)
+		if err != nil {
+			log.Panic(err)
+		}
+		builder := blockchain.NewFundingTxBuilder(pubKeyHash, &UTXOSet)
+		builder.Pending = pending
+		if feeRate == 0 {
+			feeRate = chain.EstimateFee(nodeID, blockchain.DefaultConfirmTarget)
+		}
+		builder.FeeRate = feeRate
+		if strategy != "" {
+			builder.Selector, err = blockchain.ParseCoinSelector(strategy)
+			if err != nil {
+				log.Panic(err)
+			}
+		}
+		tx, err = builder.Fund(txOutputs)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	psbt, err := chain.NewPSBT(tx)
+	if err != nil {
+		log.Panic(err)
+	}
+	fee, err := psbt.Fee()
+	if err != nil {
+		log.Panic(err)
 	}
 
-	fmt.Printf("Balance of %s: %d\n", address, balance)
+	// The inputs stay locked until the transaction is broadcast or
+	// abandoned.
+	pending.Add(&psbt.Tx, false)
+	pending.SaveFile(nodeID)
+
+	fmt.Printf("Spending %d outputs, fee %s\n", len(psbt.Inputs), fee)
+	fmt.Printf("Transaction %x\n", psbt.Tx.ID)
+	fmt.Println(psbt.Encode())
 }
 
-func (cli *CommandLine) send(from, to string, amount int, nodeID string, mineNow bool) {
-	if !wallet.ValidateAddress(to) {
-		log.Panic("Address is not Valid")
+// signPSBT signs the inputs of a partially signed transaction with the keys
+// of the wallet file, or only the key of address. It does not need the
+// chain, so it can run on a machine that is never online
+func (cli *CommandLine) signPSBT(text, address, sigHash, nodeID string) {
+	hashType, err := blockchain.ParseSigHashType(sigHash)
+	if err != nil {
+		log.Panic(err)
 	}
-	if !wallet.ValidateAddress(from) {
-		log.Panic("Address is not Valid")
+	psbt, err := blockchain.DecodePSBT(text)
+	if err != nil {
+		log.Panic(err)
 	}
-	chain := blockchain.ContinueBlockChain(nodeID)
-	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
-	defer chain.Database.Close()
 
 	wallets, err := wallet.CreateWallets(nodeID)
 	if err != nil {
 		log.Panic(err)
 	}
-	wallet := wallets.GetWallet(from)
 
-	tx := blockchain.NewTransaction(&wallet, to, amount, &UTXOSet)
-	if mineNow {
-		cbTx := blockchain.CoinbaseTx(from, "")
-		txs := []*blockchain.Transaction{cbTx, tx}
-		block := chain.MineBlock(txs)
-		UTXOSet.Update(block)
+	var addresses []string
+	if address != "" {
+		addresses = []string{address}
 	} else {
-		network.SendTx(network.KnownNodes[0], tx)
-		fmt.Println("send tx")
+		for address, w := range wallets.Wallets {
+			if psbt.Spends(wallet.PublicKeyHash(w.PublicKey)) {
+				addresses = append(addresses, address)
+			}
+		}
 	}
 
-	fmt.Println("Success!")
+	signed := 0
+	for _, address := range addresses {
+		w, err := wallets.SigningWallet(address)
+		if err != nil {
+			log.Panic(err)
+		}
+		n, err := psbt.Sign(w, hashType)
+		if err != nil {
+			log.Panic(err)
+		}
+		signed += n
+	}
+	if signed == 0 {
+		log.Panic("No unsigned input spends an output of this wallet")
+	}
+
+	fee, _ := psbt.Fee()
+	fmt.Printf("Signed %d inputs with %s, %d of %d inputs are signed, fee %s\n", signed, hashType, psbt.Signed(), len(psbt.Inputs), fee)
+	fmt.Println(psbt.Encode())
 }
 
-//listAddresses will list all addresses in the wallet file
-func (cli *CommandLine) listAddresses(nodeID string) {
-	wallets, _ := wallet.CreateWallets(nodeID)
-	addresses := wallets.GetAllAddresses()
+// combinePSBT merges copies of a partially signed transaction signed by
+// different wallets
+func (cli *CommandLine) combinePSBT(texts []string) {
+	var psbts []*blockchain.PSBT
+	for _, text := range texts {
+		psbt, err := blockchain.DecodePSBT(text)
+		if err != nil {
+			log.Panic(err)
+		}
+		psbts = append(psbts, psbt)
+	}
 
-	for _, address := range addresses {
-		fmt.Println(address)
+	combined, err := blockchain.CombinePSBT(psbts...)
+	if err != nil {
+		log.Panic(err)
 	}
 
+	fmt.Printf("%d of %d inputs are signed\n", combined.Signed(), len(combined.Inputs))
+	fmt.Println(combined.Encode())
 }
 
-//createWallet will create a wallet in the wallet file
-func (cli *CommandLine) createWallet(nodeID string) {
-	wallets, _ := wallet.CreateWallets(nodeID)
-	address := wallets.AddWallet()
-	wallets.SaveFile(nodeID)
+// finalizePSBT prints the signed raw transaction once every input of a
+// partially signed transaction is signed
+func (cli *CommandLine) finalizePSBT(text string) {
+	psbt, err := blockchain.DecodePSBT(text)
+	if err != nil {
+		log.Panic(err)
+	}
+	tx, err := psbt.Finalize()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println(blockchain.EncodeRawTransaction(tx))
+}
 
-	fmt.Printf("New address is: %s\n", address)
+func (cli *CommandLine) broadcastPSBT(text, minerAddress, nodeID string) {
+	psbt, err := blockchain.DecodePSBT(text)
+	if err != nil {
+		log.Panic(err)
+	}
+	tx, err := psbt.Finalize()
+	if err != nil {
+		log.Panic(err)
+	}
+	cli.broadcast(tx, nil, minerAddress, nodeID)
+}
+
+// abandonTransaction forgets a pending transaction of the wallet that will
+// not be confirmed, so the outputs it spends can be spent again
+func (cli *CommandLine) abandonTransaction(txID, nodeID string) {
+	id, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic("Transaction ID is not hex")
+	}
 
+	pending := blockchain.LoadPendingTxs(nodeID)
+	removed := pending.Abandon(id)
+	if removed == 0 {
+		log.Panic("Transaction is not pending in the wallet")
+	}
+	pending.SaveFile(nodeID)
+
+	fmt.Printf("Abandoned %d transactions\n", removed)
 }
 
-func (cli *CommandLine) reIndexUTXO(nodeID string) {
+// bumpFee raises the fee of a pending wallet transaction that is stuck. One
+// signalling replace-by-fee is replaced by a copy paying feeRate out of its
+// change, any other, or any with cpfp set, gets a child paying for both
+func (cli *CommandLine) bumpFee(txID string, feeRate blockchain.FeeRate, cpfp bool, minerAddress, nodeID string) {
+	id, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic("Transaction ID is not hex")
+	}
+
 	chain := blockchain.ContinueBlockChain(nodeID)
-	defer chain.Database.Close()
 	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
-	UTXOSet.ReIndex()
 
-	count := UTXOSet.CountTransactions()
-	fmt.Printf("Done! There are %d UTXOs in the database\n", count)
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	pending := blockchain.LoadPendingTxs(nodeID)
+	pending.Sync(UTXOSet)
+
+	stuck, ok := pending.Txs[hex.EncodeToString(id)]
+	if !ok || !stuck.Broadcast {
+		log.Panic("Transaction is not pending in the wallet")
+	}
+	tx := &stuck.Tx
+
+	if feeRate == 0 {
+		feeRate = chain.EstimateFee(nodeID, 1)
+		fmt.Printf("Estimated fee rate: %d per byte\n", feeRate)
+	}
+
+	var bumped *blockchain.Transaction
+	var replaces []byte
+	if !cpfp && tx.IsReplaceable() {
+		// The inputs were all signed by the wallet that paid.
+		var w *wallet.Wallet
+		for address, candidate := range wallets.Wallets {
+			if tx.Inputs[0].UsesKey(wallet.PublicKeyHash(candidate.PublicKey)) {
+				if w, err = wallets.SigningWallet(address); err != nil {
+					log.Panic(err)
+				}
+			}
+		}
+		if w == nil {
+			log.Panic("Transaction was not paid by this wallet")
+		}
+
+		builder := blockchain.NewTxBuilder(w, &UTXOSet)
+		builder.Pending = pending
+		for _, out := range tx.Outputs {
+			for address := range wallets.Wallets {
+				if wallets.IsChange(address) && out.IsLockedWithKey(wallet.PublicKeyHash(wallets.Wallets[address].PublicKey)) {
+					builder.ChangeAddress = address
+				}
+			}
+		}
+		bumped, err = builder.BumpFee(tx, feeRate)
+		if err != nil {
+			log.Panic(err)
+		}
+		replaces = tx.ID
+	} else {
+		var w *wallet.Wallet
+		for address, candidate := range wallets.Wallets {
+			if w != nil || wallets.IsWatchOnly(address) {
+				continue
+			}
+			pubKeyHash := wallet.PublicKeyHash(candidate.PublicKey)
+			for outId, out := range tx.Outputs {
+				if out.IsLockedWithKey(pubKeyHash) && !pending.IsLocked(tx.ID, outId) {
+					if w, err = wallets.SigningWallet(address); err != nil {
+						log.Panic(err)
+					}
+				}
+			}
+		}
+		if w == nil {
+			log.Panic("Transaction pays nothing the wallet can spend")
+		}
+
+		builder := blockchain.NewTxBuilder(w, &UTXOSet)
+		builder.Pending = pending
+		builder.ChangeAddress, err = wallets.NewChangeAddress(w)
+		if err != nil {
+			log.Panic(err)
+		}
+		bumped, err = builder.ChildPaysForParent(tx, feeRate)
+		if err != nil {
+			log.Panic(err)
+		}
+		wallets.SaveFile(nodeID)
+		fmt.Printf("Child pays to %s\n", builder.ChangeAddress)
+	}
+
+	fee, err := chain.TransactionFeeWith(bumped, pending.Unconfirmed())
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Paying fee %s\n", fee)
+	chain.Database.Close()
+
+	cli.broadcast(bumped, replaces, minerAddress, nodeID)
 }
 
 func (cli *CommandLine) startNode(nodeID, minerAddress string) {
@@ -181,22 +1488,156 @@ func (cli *CommandLine) Run() {
 		runtime.Goexit()
 	}
 
+	if maturity := os.Getenv("COINBASE_MATURITY"); maturity != "" {
+		depth, err := strconv.Atoi(maturity)
+		if err != nil || depth < 0 {
+			log.Panic("COINBASE_MATURITY must be a non-negative number of blocks")
+		}
+		blockchain.CoinbaseMaturity = depth
+	}
+	if drift := os.Getenv("MAX_FUTURE_BLOCK_TIME"); drift != "" {
+		duration, err := time.ParseDuration(drift)
+		if err != nil || duration < 0 {
+			log.Panic("MAX_FUTURE_BLOCK_TIME must be a duration such as 2h")
+		}
+		blockchain.MaxFutureBlockTime = duration
+	}
+
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	sendManyCmd := flag.NewFlagSet("sendmany", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
+	dumpPrivKeyCmd := flag.NewFlagSet("dumpprivkey", flag.ExitOnError)
+	importPrivKeyCmd := flag.NewFlagSet("importprivkey", flag.ExitOnError)
+	importAddressCmd := flag.NewFlagSet("importaddress", flag.ExitOnError)
+	vanityAddressCmd := flag.NewFlagSet("vanityaddress", flag.ExitOnError)
+	signMessageCmd := flag.NewFlagSet("signmessage", flag.ExitOnError)
+	verifyMessageCmd := flag.NewFlagSet("verifymessage", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
 	reIndexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	verifyChainCmd := flag.NewFlagSet("verifychain", flag.ExitOnError)
+	estimateFeeCmd := flag.NewFlagSet("estimatefee", flag.ExitOnError)
+	abandonTxCmd := flag.NewFlagSet("abandontransaction", flag.ExitOnError)
+	bumpFeeCmd := flag.NewFlagSet("bumpfee", flag.ExitOnError)
+	listWalletTxsCmd := flag.NewFlagSet("listwallettransactions", flag.ExitOnError)
+	addContactCmd := flag.NewFlagSet("addcontact", flag.ExitOnError)
+	createInvoiceCmd := flag.NewFlagSet("createinvoice", flag.ExitOnError)
+	getInvoiceCmd := flag.NewFlagSet("getinvoice", flag.ExitOnError)
+	listInvoicesCmd := flag.NewFlagSet("listinvoices", flag.ExitOnError)
+	listContactsCmd := flag.NewFlagSet("listcontacts", flag.ExitOnError)
+	createPaymentURICmd := flag.NewFlagSet("createpaymenturi", flag.ExitOnError)
+	labelTxCmd := flag.NewFlagSet("labeltransaction", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+	walletPassphraseCmd := flag.NewFlagSet("walletpassphrase", flag.ExitOnError)
+	walletPassphraseChangeCmd := flag.NewFlagSet("walletpassphrasechange", flag.ExitOnError)
+	walletLockCmd := flag.NewFlagSet("walletlock", flag.ExitOnError)
 	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	notarizeCmd := flag.NewFlagSet("notarize", flag.ExitOnError)
+	verifyReceiptCmd := flag.NewFlagSet("verifyreceipt", flag.ExitOnError)
+	createRawTxCmd := flag.NewFlagSet("createrawtransaction", flag.ExitOnError)
+	signRawTxCmd := flag.NewFlagSet("signrawtransaction", flag.ExitOnError)
+	decodeRawTxCmd := flag.NewFlagSet("decoderawtransaction", flag.ExitOnError)
+	sendRawTxCmd := flag.NewFlagSet("sendrawtransaction", flag.ExitOnError)
+	createPSBTCmd := flag.NewFlagSet("createpsbt", flag.ExitOnError)
+	signPSBTCmd := flag.NewFlagSet("signpsbt", flag.ExitOnError)
+	combinePSBTCmd := flag.NewFlagSet("combinepsbt", flag.ExitOnError)
+	finalizePSBTCmd := flag.NewFlagSet("finalizepsbt", flag.ExitOnError)
+	broadcastPSBTCmd := flag.NewFlagSet("broadcastpsbt", flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
-	sendTo := sendCmd.String("to", "", "Destination wallet address")
-	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendTo := sendCmd.String("to", "", "Destination wallet address or contact name")
+	sendURI := sendCmd.String("uri", "", "Payment request URI naming the destination, and maybe the amount")
+	sendAmount := sendCmd.String("amount", "", "Amount to send, e.g. 1.25")
 	sendMine := sendCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendManyFrom := sendManyCmd.String("from", "", "Source wallet address")
+	sendManyFile := sendManyCmd.String("file", "", "CSV or JSON file listing the payments")
+	sendManyMine := sendManyCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendManyStrategy := sendManyCmd.String("strategy", "", "Coin selection strategy: bnb, largest, smallest or random")
+	sendStrategy := sendCmd.String("strategy", "", "Coin selection strategy: bnb, largest, smallest or random")
+	sendFeeRate := sendCmd.Int64("feerate", 0, "Fee in base units per byte, 0 to use the estimated rate")
+	sendManyFeeRate := sendManyCmd.Int64("feerate", 0, "Fee in base units per byte, 0 to use the estimated rate")
+	sendUnconfirmed := sendCmd.Bool("unconfirmed", false, "Also spend outputs of pending wallet transactions")
+	sendManyUnconfirmed := sendManyCmd.Bool("unconfirmed", false, "Also spend outputs of pending wallet transactions")
+	sendReplaceable := sendCmd.Bool("rbf", false, "Signal replace-by-fee so that the fee can be bumped")
+	sendManyReplaceable := sendManyCmd.Bool("rbf", false, "Signal replace-by-fee so that the fee can be bumped")
+	abandonTxID := abandonTxCmd.String("txid", "", "ID of the pending transaction")
+	bumpFeeTxID := bumpFeeCmd.String("txid", "", "ID of the pending transaction")
+	bumpFeeRate := bumpFeeCmd.Int64("feerate", 0, "New fee in base units per byte, 0 to use the estimated rate for the next block")
+	bumpFeeCPFP := bumpFeeCmd.Bool("cpfp", false, "Send a child paying for the transaction instead of replacing it")
+	bumpFeeMiner := bumpFeeCmd.String("miner", "", "Mine the transaction on this node and send the reward to ADDRESS")
+	listWalletTxsAddress := listWalletTxsCmd.String("address", "", "Only list transactions involving this address")
+	listWalletTxsSince := listWalletTxsCmd.String("since", "", "Only list transactions from this day on")
+	listWalletTxsUntil := listWalletTxsCmd.String("until", "", "Only list transactions up to this day")
+	labelTxID := labelTxCmd.String("txid", "", "ID of the transaction")
+	labelTxLabel := labelTxCmd.String("label", "", "Label of the transaction")
+	labelTxNote := labelTxCmd.String("note", "", "Longer note about the transaction")
+	createInvoiceAmount := createInvoiceCmd.String("amount", "", "Amount to be paid, e.g. 1.25")
+	createInvoiceMemo := createInvoiceCmd.String("memo", "", "What the invoice is for")
+	createInvoiceExpiry := createInvoiceCmd.Duration("expiry", 24*time.Hour, "How long the invoice can be paid")
+	createInvoiceConfirmations := createInvoiceCmd.Int("confirmations", blockchain.DefaultInvoiceConfirmations, "Confirmations the payment needs to be confirmed")
+	getInvoiceID := getInvoiceCmd.Int("id", 0, "ID of the invoice")
+	addContactName := addContactCmd.String("name", "", "Name of the contact")
+	addContactAddress := addContactCmd.String("address", "", "Address of the contact")
+	createPaymentURIAddress := createPaymentURICmd.String("address", "", "Address to be paid")
+	createPaymentURIAmount := createPaymentURICmd.String("amount", "", "Amount asked for, e.g. 1.25")
+	createPaymentURILabel := createPaymentURICmd.String("label", "", "Name of the payee")
+	createPaymentURIMessage := createPaymentURICmd.String("message", "", "What the payment is for")
+	createWalletType := createWalletCmd.String("type", "p256", "Key type of the new wallet: p256, ed25519 or schnorr")
+	createWalletAccount := createWalletCmd.Uint("account", 0, "Account to derive a p256 key in")
+	restoreWalletMnemonic := restoreWalletCmd.String("mnemonic", "", "Words of the wallet seed, read from standard input if not given")
+	dumpPrivKeyAddress := dumpPrivKeyCmd.String("address", "", "Address whose private key is printed")
+	importPrivKeyKey := importPrivKeyCmd.String("key", "", "Private key to import, read from standard input if not given")
+	importPrivKeyRescan := importPrivKeyCmd.Bool("rescan", true, "Look up the unspent outputs of the imported key")
+	importAddressAddress := importAddressCmd.String("address", "", "Address to watch")
+	importAddressPubKey := importAddressCmd.String("pubkey", "", "Hex encoded public key whose address is watched")
+	importAddressRescan := importAddressCmd.Bool("rescan", true, "Look up the unspent outputs of the address")
+	signMessageAddress := signMessageCmd.String("address", "", "Address whose key signs the message")
+	signMessageMessage := signMessageCmd.String("message", "", "Message to sign")
+	verifyMessageAddress := verifyMessageCmd.String("address", "", "Address that signed the message")
+	vanityAddressPrefix := vanityAddressCmd.String("prefix", "", "Start of the address, including the leading 1")
+	verifyMessageSignature := verifyMessageCmd.String("signature", "", "Signature printed by signmessage")
+	verifyMessageMessage := verifyMessageCmd.String("message", "", "Message that was signed")
+	restoreWalletGap := restoreWalletCmd.Int("gap", wallet.DefaultGapLimit, "Number of unused addresses in a row that ends the scan")
+	verifyChainDepth := verifyChainCmd.Int("depth", 0, "Number of blocks to validate, 0 for the whole chain")
+	estimateFeeBlocks := estimateFeeCmd.Int("blocks", blockchain.DefaultConfirmTarget, "Number of blocks the transaction should be confirmed within")
+	verifyChainWorkers := verifyChainCmd.Int("workers", 0, "Signatures verified at the same time, 0 for one per CPU")
+	encryptWalletPassphrase := encryptWalletCmd.String("passphrase", "", "Passphrase to encrypt the wallet with, read from standard input if not given")
+	walletPassphrasePassphrase := walletPassphraseCmd.String("passphrase", "", "Passphrase of the wallet, read from standard input if not given")
+	walletPassphraseTimeout := walletPassphraseCmd.Duration("timeout", 5*time.Minute, "How long the wallet stays unlocked")
+	walletPassphraseForeground := walletPassphraseCmd.Bool("foreground", false, "Keep the wallet unlocked in this process instead of one in the background")
+	walletPassphraseChangeOld := walletPassphraseChangeCmd.String("old", "", "Current passphrase, read from standard input if not given")
+	walletPassphraseChangeNew := walletPassphraseChangeCmd.String("new", "", "New passphrase, read from standard input if not given")
 	startNodeMiner := startNodeCmd.String("miner", "", "Enable mining mode and send reward to ADDRESS")
+	notarizeFrom := notarizeCmd.String("from", "", "Wallet address paying for the anchoring transaction")
+	notarizeFiles := notarizeCmd.String("files", "", "Comma separated list of files to notarize")
+	verifyReceiptFile := verifyReceiptCmd.String("receipt", "", "Receipt file to check")
+	verifyReceiptDocument := verifyReceiptCmd.String("file", "", "Original document the receipt was issued for")
+	createRawTxHex := createRawTxCmd.String("hex", "", "Raw transaction to add the inputs and outputs to")
+	createRawTxInputs := createRawTxCmd.String("inputs", "", "Comma separated outputs to spend as TXID:INDEX")
+	createRawTxOutputs := createRawTxCmd.String("outputs", "", "Comma separated payments as ADDRESS:AMOUNT")
+	signRawTxHex := signRawTxCmd.String("hex", "", "Raw transaction to sign")
+	signRawTxAddress := signRawTxCmd.String("address", "", "Wallet address whose inputs are signed")
+	signRawTxSigHash := signRawTxCmd.String("sighash", "ALL", "Signature hash type: ALL, NONE or SINGLE, optionally with |ANYONECANPAY")
+	decodeRawTxHex := decodeRawTxCmd.String("hex", "", "Raw transaction to decode")
+	sendRawTxHex := sendRawTxCmd.String("hex", "", "Signed raw transaction to send")
+	sendRawTxMiner := sendRawTxCmd.String("miner", "", "Mine the transaction on this node and send the reward to ADDRESS")
+	createPSBTInputs := createPSBTCmd.String("inputs", "", "Comma separated outputs to spend as TXID:INDEX")
+	createPSBTOutputs := createPSBTCmd.String("outputs", "", "Comma separated payments as ADDRESS:AMOUNT")
+	createPSBTFrom := createPSBTCmd.String("from", "", "Address whose outputs fund the payments when no inputs are given")
+	createPSBTStrategy := createPSBTCmd.String("strategy", "", "Coin selection strategy: bnb, largest, smallest or random")
+	createPSBTFeeRate := createPSBTCmd.Int64("feerate", 0, "Fee in base units per byte, 0 to use the estimated rate")
+	signPSBTPSBT := signPSBTCmd.String("psbt", "", "Partially signed transaction to sign")
+	signPSBTAddress := signPSBTCmd.String("address", "", "Only sign with the key of this address")
+	signPSBTSigHash := signPSBTCmd.String("sighash", "ALL", "Signature hash type: ALL, NONE or SINGLE, optionally with |ANYONECANPAY")
+	combinePSBTPSBTs := combinePSBTCmd.String("psbts", "", "Comma separated partially signed transactions to merge")
+	finalizePSBTPSBT := finalizePSBTCmd.String("psbt", "", "Partially signed transaction to finalize")
+	broadcastPSBTPSBT := broadcastPSBTCmd.String("psbt", "", "Partially signed transaction to send")
+	broadcastPSBTMiner := broadcastPSBTCmd.String("miner", "", "Mine the transaction on this node and send the reward to ADDRESS")
 
 	switch os.Args[1] {
 	case "getbalance":
@@ -224,6 +1665,9 @@ func (cli *CommandLine) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "sendmany":
+		err := sendManyCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
 	case "listaddresses":
 		err := listAddressesCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -234,9 +1678,111 @@ func (cli *CommandLine) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "restorewallet":
+		err := restoreWalletCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "dumpprivkey":
+		err := dumpPrivKeyCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "importprivkey":
+		err := importPrivKeyCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "importaddress":
+		err := importAddressCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "vanityaddress":
+		err := vanityAddressCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "signmessage":
+		err := signMessageCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "verifymessage":
+		err := verifyMessageCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
 	case "reindexutxo":
 		err := reIndexUTXOCmd.Parse(os.Args[2:])
 		blockchain.Handle(err)
+	case "verifychain":
+		err := verifyChainCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "estimatefee":
+		err := estimateFeeCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "abandontransaction":
+		err := abandonTxCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "bumpfee":
+		err := bumpFeeCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "createinvoice":
+		err := createInvoiceCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "getinvoice":
+		err := getInvoiceCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "listinvoices":
+		err := listInvoicesCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "addcontact":
+		err := addContactCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "listcontacts":
+		err := listContactsCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "createpaymenturi":
+		err := createPaymentURICmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "listwallettransactions":
+		err := listWalletTxsCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "labeltransaction":
+		err := labelTxCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "encryptwallet":
+		err := encryptWalletCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "walletpassphrase":
+		err := walletPassphraseCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "walletpassphrasechange":
+		err := walletPassphraseChangeCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "walletlock":
+		err := walletLockCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "notarize":
+		err := notarizeCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "verifyreceipt":
+		err := verifyReceiptCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "createrawtransaction":
+		err := createRawTxCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "signrawtransaction":
+		err := signRawTxCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "decoderawtransaction":
+		err := decodeRawTxCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "sendrawtransaction":
+		err := sendRawTxCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "createpsbt":
+		err := createPSBTCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "signpsbt":
+		err := signPSBTCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "combinepsbt":
+		err := combinePSBTCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "finalizepsbt":
+		err := finalizePSBTCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "broadcastpsbt":
+		err := broadcastPSBTCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
 	default:
 		cli.printUsage()
 		runtime.Goexit()
@@ -244,10 +1790,10 @@ func (cli *CommandLine) Run() {
 
 	if getBalanceCmd.Parsed() {
 		if *getBalanceAddress == "" {
-			getBalanceCmd.Usage()
-			runtime.Goexit()
+			cli.getWalletBalance(nodeID)
+		} else {
+			cli.getBalance(*getBalanceAddress, nodeID)
 		}
-		cli.getBalance(*getBalanceAddress, nodeID)
 	}
 
 	if createBlockchainCmd.Parsed() {
@@ -263,22 +1809,295 @@ func (cli *CommandLine) Run() {
 	}
 
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		var request *blockchain.PaymentURI
+		var err error
+		if *sendURI != "" {
+			if *sendTo != "" {
+				fmt.Println("The payment URI already names the destination")
+				sendCmd.Usage()
+				runtime.Goexit()
+			}
+			request, err = blockchain.ParsePaymentURI(*sendURI)
+			if err != nil {
+				log.Panic(err)
+			}
+			if request.Amount > 0 && *sendAmount != "" {
+				fmt.Println("The payment URI already sets the amount")
+				sendCmd.Usage()
+				runtime.Goexit()
+			}
+			*sendTo = request.Address
+			if request.Label != "" || request.Message != "" {
+				fmt.Printf("Payment request from %s: %s\n", request.Label, request.Message)
+			}
+		}
+
+		hasAmount := *sendAmount != "" || (request != nil && request.Amount > 0)
+		if *sendFrom == "" || *sendTo == "" || !hasAmount {
+			sendCmd.Usage()
+			runtime.Goexit()
+		}
+		var amount blockchain.Amount
+		if *sendAmount != "" {
+			amount, err = blockchain.ParseAmount(*sendAmount)
+			if err != nil || amount == 0 {
+				fmt.Println("Amount must be a positive number of coins")
+				sendCmd.Usage()
+				runtime.Goexit()
+			}
+		} else {
+			amount = request.Amount
+		}
+
+		if *sendFeeRate < 0 {
+			fmt.Println("Fee rate can not be negative")
 			sendCmd.Usage()
 			runtime.Goexit()
 		}
 
-		cli.send(*sendFrom, *sendTo, *sendAmount, nodeID, *sendMine)
+		cli.send(*sendFrom, *sendTo, amount, request, *sendStrategy, blockchain.FeeRate(*sendFeeRate), *sendUnconfirmed, *sendReplaceable, nodeID, *sendMine)
 	}
 	if listAddressesCmd.Parsed() {
 		cli.listAddresses(nodeID)
 	}
 	if createWalletCmd.Parsed() {
-		cli.createWallet(nodeID)
+		cli.createWallet(*createWalletType, *createWalletAccount, nodeID)
+	}
+	if restoreWalletCmd.Parsed() {
+		cli.restoreWallet(*restoreWalletMnemonic, *restoreWalletGap, nodeID)
+	}
+	if dumpPrivKeyCmd.Parsed() {
+		if *dumpPrivKeyAddress == "" {
+			dumpPrivKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.dumpPrivKey(*dumpPrivKeyAddress, nodeID)
+	}
+	if vanityAddressCmd.Parsed() {
+		if err := wallet.ValidateVanityPrefix(*vanityAddressPrefix); err != nil {
+			fmt.Println(err)
+			vanityAddressCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.vanityAddress(*vanityAddressPrefix, nodeID)
+	}
+	if importPrivKeyCmd.Parsed() {
+		cli.importPrivKey(*importPrivKeyKey, *importPrivKeyRescan, nodeID)
+	}
+	if importAddressCmd.Parsed() {
+		if (*importAddressAddress == "") == (*importAddressPubKey == "") {
+			importAddressCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.importAddress(*importAddressAddress, *importAddressPubKey, *importAddressRescan, nodeID)
+	}
+	if signMessageCmd.Parsed() {
+		if *signMessageAddress == "" || *signMessageMessage == "" {
+			signMessageCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.signMessage(*signMessageAddress, *signMessageMessage, nodeID)
+	}
+	if verifyMessageCmd.Parsed() {
+		if *verifyMessageAddress == "" || *verifyMessageSignature == "" || *verifyMessageMessage == "" {
+			verifyMessageCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.verifyMessage(*verifyMessageAddress, *verifyMessageSignature, *verifyMessageMessage)
 	}
 	if reIndexUTXOCmd.Parsed() {
 		cli.reIndexUTXO(nodeID)
 	}
+	if sendManyCmd.Parsed() {
+		if *sendManyFrom == "" || *sendManyFile == "" || *sendManyFeeRate < 0 {
+			sendManyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.sendMany(*sendManyFrom, *sendManyFile, *sendManyStrategy, blockchain.FeeRate(*sendManyFeeRate), *sendManyUnconfirmed, *sendManyReplaceable, nodeID, *sendManyMine)
+	}
+	if encryptWalletCmd.Parsed() {
+		cli.encryptWallet(*encryptWalletPassphrase, nodeID)
+	}
+	if walletPassphraseCmd.Parsed() {
+		if *walletPassphraseTimeout <= 0 {
+			walletPassphraseCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.walletPassphrase(*walletPassphrasePassphrase, *walletPassphraseTimeout, *walletPassphraseForeground, nodeID)
+	}
+	if walletPassphraseChangeCmd.Parsed() {
+		cli.walletPassphraseChange(*walletPassphraseChangeOld, *walletPassphraseChangeNew, nodeID)
+	}
+	if walletLockCmd.Parsed() {
+		cli.walletLock(nodeID)
+	}
+	if abandonTxCmd.Parsed() {
+		if *abandonTxID == "" {
+			abandonTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.abandonTransaction(*abandonTxID, nodeID)
+	}
+	if bumpFeeCmd.Parsed() {
+		if *bumpFeeTxID == "" || *bumpFeeRate < 0 {
+			bumpFeeCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.bumpFee(*bumpFeeTxID, blockchain.FeeRate(*bumpFeeRate), *bumpFeeCPFP, *bumpFeeMiner, nodeID)
+	}
+	if createInvoiceCmd.Parsed() {
+		if *createInvoiceAmount == "" {
+			createInvoiceCmd.Usage()
+			runtime.Goexit()
+		}
+		amount, err := blockchain.ParseAmount(*createInvoiceAmount)
+		if err != nil || amount == 0 {
+			fmt.Println("Amount must be a positive number of coins")
+			createInvoiceCmd.Usage()
+			runtime.Goexit()
+		}
+		if *createInvoiceExpiry <= 0 || *createInvoiceConfirmations < 1 {
+			fmt.Println("Expiry and confirmations must be positive")
+			createInvoiceCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createInvoice(amount, *createInvoiceMemo, *createInvoiceExpiry, *createInvoiceConfirmations, nodeID)
+	}
+	if getInvoiceCmd.Parsed() {
+		if *getInvoiceID < 1 {
+			getInvoiceCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getInvoice(*getInvoiceID, nodeID)
+	}
+	if listInvoicesCmd.Parsed() {
+		cli.listInvoices(nodeID)
+	}
+	if addContactCmd.Parsed() {
+		if *addContactName == "" || *addContactAddress == "" {
+			addContactCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.addContact(*addContactName, *addContactAddress, nodeID)
+	}
+	if listContactsCmd.Parsed() {
+		cli.listContacts(nodeID)
+	}
+	if createPaymentURICmd.Parsed() {
+		if *createPaymentURIAddress == "" {
+			createPaymentURICmd.Usage()
+			runtime.Goexit()
+		}
+		var amount blockchain.Amount
+		if *createPaymentURIAmount != "" {
+			var err error
+			amount, err = blockchain.ParseAmount(*createPaymentURIAmount)
+			if err != nil || amount == 0 {
+				fmt.Println("Amount must be a positive number of coins")
+				createPaymentURICmd.Usage()
+				runtime.Goexit()
+			}
+		}
+		cli.createPaymentURI(*createPaymentURIAddress, amount, *createPaymentURILabel, *createPaymentURIMessage)
+	}
+	if listWalletTxsCmd.Parsed() {
+		cli.listWalletTransactions(*listWalletTxsAddress, *listWalletTxsSince, *listWalletTxsUntil, nodeID)
+	}
+	if labelTxCmd.Parsed() {
+		if *labelTxID == "" || *labelTxLabel == "" {
+			labelTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.labelTransaction(*labelTxID, *labelTxLabel, *labelTxNote, nodeID)
+	}
+	if estimateFeeCmd.Parsed() {
+		if *estimateFeeBlocks < 1 || *estimateFeeBlocks > blockchain.MaxConfirmTarget {
+			fmt.Printf("Blocks must be between 1 and %d\n", blockchain.MaxConfirmTarget)
+			estimateFeeCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.estimateFee(*estimateFeeBlocks, nodeID)
+	}
+	if verifyChainCmd.Parsed() {
+		cli.verifyChain(*verifyChainDepth, *verifyChainWorkers, nodeID)
+	}
+	if notarizeCmd.Parsed() {
+		if *notarizeFrom == "" || *notarizeFiles == "" {
+			notarizeCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.notarize(*notarizeFrom, strings.Split(*notarizeFiles, ","), nodeID)
+	}
+	if verifyReceiptCmd.Parsed() {
+		if *verifyReceiptFile == "" {
+			verifyReceiptCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.verifyReceipt(*verifyReceiptFile, *verifyReceiptDocument)
+	}
+	if createRawTxCmd.Parsed() {
+		if *createRawTxInputs == "" && *createRawTxOutputs == "" {
+			createRawTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createRawTransaction(*createRawTxHex, *createRawTxInputs, *createRawTxOutputs)
+	}
+	if signRawTxCmd.Parsed() {
+		if *signRawTxHex == "" || *signRawTxAddress == "" {
+			signRawTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.signRawTransaction(*signRawTxHex, *signRawTxAddress, *signRawTxSigHash, nodeID)
+	}
+	if decodeRawTxCmd.Parsed() {
+		if *decodeRawTxHex == "" {
+			decodeRawTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.decodeRawTransaction(*decodeRawTxHex)
+	}
+	if sendRawTxCmd.Parsed() {
+		if *sendRawTxHex == "" {
+			sendRawTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.sendRawTransaction(*sendRawTxHex, *sendRawTxMiner, nodeID)
+	}
+	if createPSBTCmd.Parsed() {
+		if *createPSBTOutputs == "" || (*createPSBTInputs == "") == (*createPSBTFrom == "") || *createPSBTFeeRate < 0 {
+			createPSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createPSBT(*createPSBTInputs, *createPSBTOutputs, *createPSBTFrom, *createPSBTStrategy, blockchain.FeeRate(*createPSBTFeeRate), nodeID)
+	}
+	if signPSBTCmd.Parsed() {
+		if *signPSBTPSBT == "" {
+			signPSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.signPSBT(*signPSBTPSBT, *signPSBTAddress, *signPSBTSigHash, nodeID)
+	}
+	if combinePSBTCmd.Parsed() {
+		if *combinePSBTPSBTs == "" {
+			combinePSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.combinePSBT(strings.Split(*combinePSBTPSBTs, ","))
+	}
+	if finalizePSBTCmd.Parsed() {
+		if *finalizePSBTPSBT == "" {
+			finalizePSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.finalizePSBT(*finalizePSBTPSBT)
+	}
+	if broadcastPSBTCmd.Parsed() {
+		if *broadcastPSBTPSBT == "" {
+			broadcastPSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.broadcastPSBT(*broadcastPSBTPSBT, *broadcastPSBTMiner, nodeID)
+	}
 	if startNodeCmd.Parsed() {
 		nodeID := os.Getenv("NODE_ID")
 		if nodeID == "" {
@@ -5,6 +5,7 @@ go 1.18
 require (
 	github.com/dgraph-io/badger v1.6.2
 	github.com/mr-tron/base58 v1.2.0
+	github.com/tyler-smith/go-bip39 v1.1.0
 	github.com/vrecan/death/v3 v3.0.3
 	golang.org/x/crypto v0.0.0-20220722155217-630584e8d5aa
 )
@@ -0,0 +1,282 @@
+package network
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/TualatinX/blockchain-go/blockchain"
+)
+
+// unconfirmedTxs returns the transactions of the memory pool by hex ID.
+func unconfirmedTxs() map[string]*blockchain.Transaction {
+	txs := make(map[string]*blockchain.Transaction)
+	for id := range memoryPool {
+		tx := memoryPool[id]
+		txs[id] = &tx
+	}
+	return txs
+}
+
+func outpoint(in blockchain.TxInput) string {
+	return fmt.Sprintf("%x:%d", in.ID, in.Out)
+}
+
+// conflicts returns the IDs of the pool transactions spending an output
+// that tx spends too.
+func conflicts(tx *blockchain.Transaction) map[string]bool {
+	spends := make(map[string]bool)
+	for _, in := range tx.Inputs {
+		spends[outpoint(in)] = true
+	}
+
+	ids := make(map[string]bool)
+	for id, poolTx := range memoryPool {
+		if bytes.Equal(poolTx.ID, tx.ID) {
+			continue
+		}
+		for _, in := range poolTx.Inputs {
+			if spends[outpoint(in)] {
+				ids[id] = true
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// withDescendants adds to ids the pool transactions spending their outputs,
+// and the ones spending those in turn.
+func withDescendants(ids map[string]bool) map[string]bool {
+	for changed := true; changed; {
+		changed = false
+		for id, poolTx := range memoryPool {
+			if ids[id] {
+				continue
+			}
+			for _, in := range poolTx.Inputs {
+				if ids[hex.EncodeToString(in.ID)] {
+					ids[id] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// evict drops transactions from the memory pool that will not be mined.
+func evict(ids map[string]bool) {
+	for id := range ids {
+		if tx, ok := memoryPool[id]; ok {
+			delete(memoryPool, id)
+			feeEstimator.RemoveTransaction(tx.ID)
+		}
+	}
+}
+
+func feeRate(fee blockchain.Amount, tx *blockchain.Transaction) blockchain.FeeRate {
+	return blockchain.FeeRate(fee / blockchain.Amount(len(tx.Serialize())))
+}
+
+// acceptToMemoryPool validates tx and adds it to the memory pool. A
+// transaction spending the same outputs as some in the pool replaces them
+// and their descendants if all of them signal replace-by-fee, and it pays a
+// higher fee than all of them together and a higher fee rate than each one
+// it conflicts with.
+func acceptToMemoryPool(tx *blockchain.Transaction, chain *blockchain.BlockChain) error {
+	replaced := conflicts(tx)
+	for id := range replaced {
+		conflict := memoryPool[id]
+		if !conflict.IsReplaceable() {
+			return fmt.Errorf("spends the same outputs as %s, which does not signal replace-by-fee", id)
+		}
+	}
+	direct := make([]string, 0, len(replaced))
+	for id := range replaced {
+		direct = append(direct, id)
+	}
+	replaced = withDescendants(replaced)
+
+	unconfirmed := unconfirmedTxs()
+	for id := range replaced {
+		delete(unconfirmed, id)
+	}
+	for _, in := range tx.Inputs {
+		if replaced[hex.EncodeToString(in.ID)] {
+			return errors.New("spends an output of a transaction it replaces")
+		}
+	}
+	if err := chain.ValidateTransactionWith(tx, chain.GetBestHeight()+1, unconfirmed); err != nil {
+		return err
+	}
+
+	if len(replaced) > 0 {
+		fee, err := chain.TransactionFeeWith(tx, unconfirmed)
+		if err != nil {
+			return err
+		}
+		all := unconfirmedTxs()
+
+		var replacedFees []blockchain.Amount
+		for id := range replaced {
+			replacedFee, err := chain.TransactionFeeWith(all[id], all)
+			if err != nil {
+				return err
+			}
+			replacedFees = append(replacedFees, replacedFee)
+		}
+		total, err := blockchain.SumAmounts(replacedFees...)
+		if err != nil {
+			return err
+		}
+		if fee <= total {
+			return fmt.Errorf("fee of %s is not above the %s paid by the transactions it replaces", fee, total)
+		}
+
+		for _, id := range direct {
+			conflictFee, err := chain.TransactionFeeWith(all[id], all)
+			if err != nil {
+				return err
+			}
+			if feeRate(fee, tx) <= feeRate(conflictFee, all[id]) {
+				return fmt.Errorf("fee rate of %d per byte is not above the %d paid by %s", feeRate(fee, tx), feeRate(conflictFee, all[id]), id)
+			}
+		}
+
+		evict(replaced)
+		fmt.Printf("Replaced %d transactions with tx %x\n", len(replaced), tx.ID)
+	}
+
+	memoryPool[hex.EncodeToString(tx.ID)] = *tx
+	return nil
+}
+
+// removeConflicts drops the pool transactions that spend an output also
+// spent in block, which can never be mined now, and their descendants.
+func removeConflicts(block *blockchain.Block) {
+	ids := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for id := range conflicts(tx) {
+			ids[id] = true
+		}
+	}
+	evict(withDescendants(ids))
+}
+
+// blockTemplate picks the pool transactions for the next block. They are
+// taken together with their unconfirmed ancestors, by the fee rate of the
+// whole package, so that a parent paying too little is still mined when a
+// child pays enough for both. Packages paying less than MinFeeRate are left
+// out.
+func blockTemplate(chain *blockchain.BlockChain) []*blockchain.Transaction {
+	pool := unconfirmedTxs()
+	fees := make(map[string]blockchain.Amount)
+	for id, tx := range pool {
+		fee, err := chain.TransactionFeeWith(tx, pool)
+		if err != nil {
+			continue
+		}
+		fees[id] = fee
+	}
+
+	// ancestors returns the package of tx: its pool ancestors not in the
+	// block yet, and tx itself.
+	ancestors := func(tx *blockchain.Transaction, included map[string]*blockchain.Transaction) []*blockchain.Transaction {
+		var pkg []*blockchain.Transaction
+		seen := make(map[string]bool)
+
+		var visit func(tx *blockchain.Transaction)
+		visit = func(tx *blockchain.Transaction) {
+			id := hex.EncodeToString(tx.ID)
+			if seen[id] || included[id] != nil {
+				return
+			}
+			seen[id] = true
+			for _, in := range tx.Inputs {
+				if parent, ok := pool[hex.EncodeToString(in.ID)]; ok {
+					visit(parent)
+				}
+			}
+			pkg = append(pkg, tx)
+		}
+		visit(tx)
+		return pkg
+	}
+
+	ids := make([]string, 0, len(fees))
+	for id := range fees {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	height := chain.GetBestHeight() + 1
+	var txs []*blockchain.Transaction
+	included := make(map[string]*blockchain.Transaction)
+	rejected := make(map[string]bool)
+	for {
+		var best []*blockchain.Transaction
+		var bestRate blockchain.FeeRate
+		for _, id := range ids {
+			if included[id] != nil || rejected[id] {
+				continue
+			}
+			pkg := ancestors(pool[id], included)
+
+			var pkgFee blockchain.Amount
+			pkgSize := 0
+			complete := true
+			for _, tx := range pkg {
+				fee, ok := fees[hex.EncodeToString(tx.ID)]
+				if !ok {
+					complete = false
+					break
+				}
+				pkgFee += fee
+				pkgSize += len(tx.Serialize())
+			}
+			if !complete {
+				rejected[id] = true
+				continue
+			}
+
+			rate := blockchain.FeeRate(pkgFee / blockchain.Amount(pkgSize))
+			if best == nil || rate > bestRate {
+				best, bestRate = pkg, rate
+			}
+		}
+		if best == nil || bestRate < blockchain.MinFeeRate {
+			break
+		}
+
+		// The whole package goes in, or none of it.
+		added := make(map[string]*blockchain.Transaction)
+		for id, tx := range included {
+			added[id] = tx
+		}
+		valid := true
+		for _, tx := range best {
+			if err := chain.ValidateTransactionWith(tx, height, added); err != nil {
+				valid = false
+				break
+			}
+			added[hex.EncodeToString(tx.ID)] = tx
+		}
+		if !valid {
+			rejected[hex.EncodeToString(best[len(best)-1].ID)] = true
+			continue
+		}
+
+		for _, tx := range best {
+			included[hex.EncodeToString(tx.ID)] = tx
+			txs = append(txs, tx)
+		}
+	}
+	return txs
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/TualatinX/blockchain-go/blockchain"
+	"github.com/TualatinX/blockchain-go/wallet"
 	"io"
 	"io/ioutil"
 	"log"
@@ -13,6 +14,7 @@ import (
 	"os"
 	"runtime"
 	"syscall"
+	"time"
 
 	"github.com/vrecan/death/v3"
 )
@@ -29,6 +31,8 @@ var (
 	KnownNodes      = []string{"localhost:3000"}
 	blocksInTransit = [][]byte{}
 	memoryPool      = make(map[string]blockchain.Transaction)
+	feeEstimator    = blockchain.NewFeeEstimator()
+	localNodeID     string
 )
 
 type Addr struct {
@@ -66,6 +70,7 @@ type Version struct {
 	Version    int
 	BestHeight int // length of actual chain
 	AddrFrom   string
+	Timestamp  int64 // clock of the sender, used for network-adjusted time
 }
 
 func CmdToBytes(cmd string) []byte {
@@ -192,7 +197,7 @@ func SendTx(addr string, tnx *blockchain.Transaction) {
 
 func SendVersion(addr string, chain *blockchain.BlockChain) {
 	bestHeight := chain.GetBestHeight()
-	payload := GobEncode(Version{version, bestHeight, nodeAddress})
+	payload := GobEncode(Version{version, bestHeight, nodeAddress, time.Now().Unix()})
 
 	request := append(CmdToBytes("version"), payload...)
 
@@ -245,9 +250,15 @@ func HandleBlock(request []byte, chain *blockchain.BlockChain) {
 	block := blockchain.Deserialize(blockData)
 
 	fmt.Println("Recevied a new block!")
-	chain.AddBlock(block)
+	start := time.Now()
+	if err := chain.AddBlock(block); err != nil {
+		fmt.Printf("Rejected block %x: %s\n", block.Hash, err)
+		blocksInTransit = [][]byte{}
+		return
+	}
 
-	fmt.Printf("Added block %x\n", block.Hash)
+	fmt.Printf("Added block %x in %s\n", block.Hash, time.Since(start))
+	confirmBlock(chain, block)
 
 	if len(blocksInTransit) > 0 {
 		blockHash := blocksInTransit[0]
@@ -314,6 +325,10 @@ func HandleVersion(request []byte, chain *blockchain.BlockChain) {
 		log.Panic(err)
 	}
 
+	if payload.Timestamp != 0 {
+		blockchain.AddTimeSample(payload.AddrFrom, payload.Timestamp)
+	}
+
 	bestHeight := chain.GetBestHeight()
 	otherHeight := payload.BestHeight
 
@@ -341,7 +356,18 @@ func HandleTx(request []byte, chain *blockchain.BlockChain) {
 
 	txData := payload.Transaction
 	tx := blockchain.DeserializeTransaction(txData)
-	memoryPool[hex.EncodeToString(tx.ID)] = tx
+
+	if tx.IsCoinbase() {
+		fmt.Printf("Rejected tx %x: coinbase outside a block\n", tx.ID)
+		return
+	}
+	if err := acceptToMemoryPool(&tx, chain); err != nil {
+		fmt.Printf("Rejected tx %x: %s\n", tx.ID, err)
+		return
+	}
+	if rate, err := chain.TransactionFeeRate(&tx); err == nil {
+		feeEstimator.ProcessTransaction(&tx, rate, chain.GetBestHeight())
+	}
 
 	fmt.Printf("%s, %d", nodeAddress, len(memoryPool))
 
@@ -359,14 +385,9 @@ func HandleTx(request []byte, chain *blockchain.BlockChain) {
 }
 
 func MineTx(chain *blockchain.BlockChain) {
-	var txs []*blockchain.Transaction
-
-	for id := range memoryPool {
-		fmt.Printf("tx: %s\n", memoryPool[id].ID)
-		tx := memoryPool[id]
-		if chain.VerifyTransaction(&tx) {
-			txs = append(txs, &tx)
-		}
+	txs := blockTemplate(chain)
+	for _, tx := range txs {
+		fmt.Printf("tx: %x\n", tx.ID)
 	}
 
 	if len(txs) == 0 {
@@ -375,18 +396,14 @@ func MineTx(chain *blockchain.BlockChain) {
 	}
 
 	cbTx := blockchain.CoinbaseTx(mineAddress, "")
-	txs = append(txs, cbTx)
+	txs = append([]*blockchain.Transaction{cbTx}, txs...)
 
 	newBlock := chain.MineBlock(txs)
 	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
 	UTXOSet.ReIndex()
 
 	fmt.Println("New Block mined")
-
-	for _, tx := range txs {
-		txID := hex.EncodeToString(tx.ID)
-		delete(memoryPool, txID)
-	}
+	confirmBlock(chain, newBlock)
 
 	for _, node := range KnownNodes {
 		if node != nodeAddress {
@@ -399,6 +416,35 @@ func MineTx(chain *blockchain.BlockChain) {
 	}
 }
 
+// confirmBlock drops the transactions of a new block from the memory pool,
+// tells the fee estimator how long they waited there, adds those of the
+// node's wallet to its history and reports the invoices it pays.
+func confirmBlock(chain *blockchain.BlockChain, block *blockchain.Block) {
+	for _, tx := range block.Transactions {
+		delete(memoryPool, hex.EncodeToString(tx.ID))
+	}
+	removeConflicts(block)
+
+	feeEstimator.ProcessBlock(block)
+	if err := feeEstimator.SaveFile(localNodeID); err != nil {
+		fmt.Printf("Could not save fee estimates: %s\n", err)
+	}
+
+	if wallets, err := wallet.CreateWallets(localNodeID); err == nil {
+		chain.SyncWalletHistory(wallets, blockchain.LoadPendingTxs(localNodeID).Unconfirmed())
+		wallets.SaveHistory(localNodeID)
+	}
+
+	invoices := blockchain.LoadInvoices(localNodeID)
+	changed, settled := invoices.Update(chain, time.Now().Unix())
+	for _, inv := range changed {
+		fmt.Printf("Invoice %d is %s\n", inv.ID, inv.Describe(block.Height))
+	}
+	if len(changed) > 0 || settled > 0 {
+		invoices.SaveFile(localNodeID)
+	}
+}
+
 func HandleInv(request []byte, chain *blockchain.BlockChain) {
 	var buff bytes.Buffer
 	var payload Inv
@@ -413,6 +459,11 @@ func HandleInv(request []byte, chain *blockchain.BlockChain) {
 	fmt.Printf("Recevied inventory with %d %s\n", len(payload.Items), payload.Type)
 
 	if payload.Type == "block" {
+		// Hashes come newest first. Fetch them oldest first so that every
+		// block arrives after its parent and can be validated.
+		for i, j := 0, len(payload.Items)-1; i < j; i, j = i+1, j-1 {
+			payload.Items[i], payload.Items[j] = payload.Items[j], payload.Items[i]
+		}
 		blocksInTransit = payload.Items
 
 		blockHash := payload.Items[0]
@@ -470,6 +521,8 @@ func HandleConnection(conn net.Conn, chain *blockchain.BlockChain) {
 func StartServer(nodeID, minerAddress string) {
 	nodeAddress = fmt.Sprintf("localhost:%s", nodeID)
 	mineAddress = minerAddress
+	localNodeID = nodeID
+	feeEstimator = blockchain.LoadFeeEstimator(nodeID)
 	ln, err := net.Listen(protocol, nodeAddress)
 	if err != nil {
 		log.Panic(err)
@@ -0,0 +1,68 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Contact is a named address of the address book.
+type Contact struct {
+	Name    string
+	Address string
+}
+
+// AddContact saves address under name, replacing the address the name had.
+// It reports whether the name was already in the address book.
+func (ws *Wallets) AddContact(name, address string) (bool, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return false, errors.New("contact name is empty")
+	}
+	if ValidateAddress(name) {
+		return false, errors.New("contact name can not be an address")
+	}
+	if !ValidateAddress(address) {
+		return false, fmt.Errorf("address %q is not valid", address)
+	}
+
+	if ws.Contacts == nil {
+		ws.Contacts = make(map[string]*Contact)
+	}
+	_, replaced := ws.Contacts[name]
+	ws.Contacts[name] = &Contact{name, address}
+	return replaced, nil
+}
+
+// ListContacts returns the address book sorted by name.
+func (ws *Wallets) ListContacts() []*Contact {
+	var contacts []*Contact
+	for _, c := range ws.Contacts {
+		contacts = append(contacts, c)
+	}
+	sort.Slice(contacts, func(i, j int) bool { return contacts[i].Name < contacts[j].Name })
+	return contacts
+}
+
+// ContactName returns the name address is saved under, if any.
+func (ws *Wallets) ContactName(address string) (string, bool) {
+	for _, c := range ws.ListContacts() {
+		if c.Address == address {
+			return c.Name, true
+		}
+	}
+	return "", false
+}
+
+// ResolveAddress returns the address a payee stands for: the payee itself
+// when it is an address, the address of the contact of that name otherwise.
+func (ws *Wallets) ResolveAddress(payee string) (string, error) {
+	if ValidateAddress(payee) {
+		return payee, nil
+	}
+	if c, ok := ws.Contacts[payee]; ok {
+		return c.Address, nil
+	}
+	return "", fmt.Errorf("%q is neither a valid address nor a contact", payee)
+}
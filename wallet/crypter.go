@@ -0,0 +1,354 @@
+package wallet
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// The private keys of an encrypted wallet file are sealed with a random
+// master key. The master key is in turn sealed with a key derived from the
+// passphrase, so changing the passphrase only re-seals the master key.
+
+// While the wallet is unlocked, the process holding the master key listens
+// on a socket in agentDir, which only its owner can open.
+const (
+	agentDir     = "./tmp/wallets_%s.agent"
+	agentSocket  = "agent.sock"
+	agentTimeout = time.Second
+)
+
+// scrypt cost parameters for new passphrases, about 32 MB of memory.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var (
+	ErrWalletLocked      = errors.New("wallet is locked, unlock it with walletpassphrase")
+	ErrWrongPassphrase   = errors.New("the passphrase is incorrect")
+	ErrWalletEncrypted   = errors.New("wallet is already encrypted")
+	ErrWalletUnencrypted = errors.New("wallet is not encrypted")
+)
+
+// Encryption holds what is needed to recover the master key from the
+// passphrase.
+type Encryption struct {
+	Salt    []byte
+	N, R, P int
+
+	// MasterKey is the sealed master key.
+	MasterKey []byte
+}
+
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func unseal(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed data is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newEncryption(passphrase, masterKey []byte) (*Encryption, error) {
+	enc := &Encryption{Salt: make([]byte, 16), N: scryptN, R: scryptR, P: scryptP}
+	if _, err := rand.Read(enc.Salt); err != nil {
+		return nil, err
+	}
+
+	key, err := enc.passphraseKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	enc.MasterKey, err = seal(key, masterKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+func (enc *Encryption) passphraseKey(passphrase []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, enc.Salt, enc.N, enc.R, enc.P, chacha20poly1305.KeySize)
+}
+
+func (enc *Encryption) masterKey(passphrase []byte) ([]byte, error) {
+	key, err := enc.passphraseKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	masterKey, err := unseal(key, enc.MasterKey, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return masterKey, nil
+}
+
+func (ws *Wallets) IsEncrypted() bool {
+	return ws.Encryption != nil
+}
+
+// IsLocked tells whether the private keys are unavailable because the wallet
+// is encrypted and has not been unlocked.
+func (ws *Wallets) IsLocked() bool {
+	return ws.IsEncrypted() && ws.masterKey == nil
+}
+
+// Encrypt seals every private key under a new master key protected by the
+// passphrase. The keys stay usable until the wallet is loaded again.
+func (ws *Wallets) Encrypt(passphrase []byte) error {
+	if ws.IsEncrypted() {
+		return ErrWalletEncrypted
+	}
+	if len(passphrase) == 0 {
+		return errors.New("passphrase is empty")
+	}
+
+	masterKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(masterKey); err != nil {
+		return err
+	}
+	enc, err := newEncryption(passphrase, masterKey)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range ws.Wallets {
+		if err := w.encrypt(masterKey); err != nil {
+			return err
+		}
+	}
+	if ws.HasHDChain() {
+		if err := ws.HD.encrypt(masterKey); err != nil {
+			return err
+		}
+	}
+	ws.Encryption = enc
+	ws.masterKey = masterKey
+	return nil
+}
+
+// ChangePassphrase re-seals the master key under a new passphrase.
+func (ws *Wallets) ChangePassphrase(oldPassphrase, newPassphrase []byte) error {
+	if !ws.IsEncrypted() {
+		return ErrWalletUnencrypted
+	}
+	if len(newPassphrase) == 0 {
+		return errors.New("passphrase is empty")
+	}
+
+	masterKey, err := ws.Encryption.masterKey(oldPassphrase)
+	if err != nil {
+		return err
+	}
+	enc, err := newEncryption(newPassphrase, masterKey)
+	if err != nil {
+		return err
+	}
+	ws.Encryption = enc
+	return nil
+}
+
+// Unlock decrypts the private keys with the passphrase.
+func (ws *Wallets) Unlock(passphrase []byte) error {
+	if !ws.IsEncrypted() {
+		return ErrWalletUnencrypted
+	}
+	masterKey, err := ws.Encryption.masterKey(passphrase)
+	if err != nil {
+		return err
+	}
+	return ws.unlock(masterKey)
+}
+
+func (ws *Wallets) unlock(masterKey []byte) error {
+	for address, w := range ws.Wallets {
+		if err := w.decrypt(masterKey); err != nil {
+			return fmt.Errorf("could not decrypt the key of %s: %s", address, err)
+		}
+	}
+	if ws.HasHDChain() {
+		if err := ws.HD.decrypt(masterKey); err != nil {
+			return fmt.Errorf("could not decrypt the seed: %s", err)
+		}
+	}
+	ws.masterKey = masterKey
+	return nil
+}
+
+// encrypt moves the private key into EncryptedKey. The public key is bound
+// to the ciphertext, so sealed keys cannot be swapped between entries.
+func (w *Wallet) encrypt(masterKey []byte) error {
+	sealed, err := seal(masterKey, w.PrivateKey, w.PublicKey)
+	if err != nil {
+		return err
+	}
+	w.EncryptedKey = sealed
+	return nil
+}
+
+func (w *Wallet) decrypt(masterKey []byte) error {
+	privateKey, err := unseal(masterKey, w.EncryptedKey, w.PublicKey)
+	if err != nil {
+		return err
+	}
+	w.PrivateKey = privateKey
+	return nil
+}
+
+// WalletPassphrase unlocks the wallet file of the node for the given time.
+// The master key is only kept in the memory of this process, which hands it
+// to the commands of the node over a socket that only the owner can open.
+// It forgets the key and returns when the time is up or LockWallet is
+// called. ready is called once commands can use the unlocked wallet.
+func WalletPassphrase(nodeId string, passphrase []byte, timeout time.Duration, ready func()) error {
+	wallets, err := CreateWallets(nodeId)
+	if err != nil {
+		return err
+	}
+	if err := wallets.Unlock(passphrase); err != nil {
+		return err
+	}
+	masterKey := wallets.masterKey
+
+	// Only one process holds the key of a wallet at a time.
+	if err := LockWallet(nodeId); err != nil {
+		return err
+	}
+	dir := fmt.Sprintf(agentDir, nodeId)
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	listener, err := net.Listen("unix", filepath.Join(dir, agentSocket))
+	if err != nil {
+		return err
+	}
+	expiry := time.AfterFunc(timeout, func() { listener.Close() })
+	defer expiry.Stop()
+
+	ready()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			break
+		}
+		if serveAgent(conn, masterKey) {
+			listener.Close()
+			break
+		}
+	}
+	for i := range masterKey {
+		masterKey[i] = 0
+	}
+	return nil
+}
+
+// serveAgent answers a request for the master key and reports whether the
+// wallet should be locked instead.
+func serveAgent(conn net.Conn, masterKey []byte) bool {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(agentTimeout))
+
+	request, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	switch strings.TrimSpace(request) {
+	case "key":
+		conn.Write(masterKey)
+	case "lock":
+		return true
+	}
+	return false
+}
+
+// askAgent sends a request to the process keeping the node's wallet
+// unlocked and returns its answer.
+func askAgent(nodeId, request string) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", filepath.Join(fmt.Sprintf(agentDir, nodeId), agentSocket), agentTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(agentTimeout))
+
+	if _, err := conn.Write([]byte(request + "\n")); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(conn)
+}
+
+// LockWallet makes the process keeping the node's wallet unlocked forget
+// the master key.
+func LockWallet(nodeId string) error {
+	dir := fmt.Sprintf(agentDir, nodeId)
+	if _, err := askAgent(nodeId, "lock"); err == nil {
+		// The agent removes its socket as it exits.
+		for i := 0; i < 50; i++ {
+			if _, err := os.Stat(dir); os.IsNotExist(err) {
+				return nil
+			}
+			time.Sleep(agentTimeout / 50)
+		}
+	}
+	// Nothing answers on a socket left by a process that was killed.
+	return os.RemoveAll(dir)
+}
+
+// loadSession unlocks ws with the master key held by WalletPassphrase, if a
+// process still holds it.
+func (ws *Wallets) loadSession(nodeId string) {
+	masterKey, err := askAgent(nodeId, "key")
+	if err != nil || len(masterKey) == 0 {
+		return
+	}
+	if err := ws.unlock(masterKey); err != nil {
+		ws.lock()
+	}
+}
+
+func (ws *Wallets) lock() {
+	ws.masterKey = nil
+	for _, w := range ws.Wallets {
+		w.PrivateKey = nil
+	}
+	if ws.HasHDChain() {
+		ws.HD.Mnemonic = ""
+	}
+}
+
+// writePrivateFile writes a file only its owner can read, tightening the
+// mode of a file that already exists.
+func writePrivateFile(path string, data []byte) error {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0600)
+}
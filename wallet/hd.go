@@ -0,0 +1,300 @@
+package wallet
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Keys are derived from the seed as in BIP 32, using the SLIP 10 rules for
+// P-256, along the path m/44'/1'/account'/chain/index.
+
+const HardenedKeyStart = uint32(0x80000000)
+
+const (
+	hdPurpose  = 44
+	hdCoinType = 1
+
+	// ExternalChain holds the addresses handed out to be paid to, ChangeChain
+	// the ones receiving change.
+	ExternalChain = uint32(0)
+	ChangeChain   = uint32(1)
+
+	// DefaultGapLimit is how many unused addresses in a row end the scan of
+	// a chain when restoring.
+	DefaultGapLimit = 20
+
+	mnemonicEntropyBits = 128
+)
+
+var masterKeySalt = []byte("Nist256p1 seed")
+
+// HDChain is the seed of a hierarchical deterministic wallet and how far
+// each of its chains has been used.
+type HDChain struct {
+	// Mnemonic is empty while an encrypted wallet is locked.
+	Mnemonic          string
+	EncryptedMnemonic []byte
+
+	// Next holds, for every account, the index of the next key on the
+	// external and the change chain.
+	Next map[uint32][]uint32
+}
+
+type extendedKey struct {
+	key       []byte
+	chainCode []byte
+}
+
+func newMasterKey(seed []byte) *extendedKey {
+	n := elliptic.P256().Params().N
+
+	data := seed
+	for {
+		mac := hmac.New(sha512.New, masterKeySalt)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		il := new(big.Int).SetBytes(sum[:32])
+		if il.Sign() != 0 && il.Cmp(n) < 0 {
+			return &extendedKey{sum[:32], sum[32:]}
+		}
+		data = sum
+	}
+}
+
+// child derives the child key at index. Indexes from HardenedKeyStart on
+// are hardened and can only be derived from the private key.
+func (k *extendedKey) child(index uint32) *extendedKey {
+	n := elliptic.P256().Params().N
+
+	var data []byte
+	if index >= HardenedKeyStart {
+		data = append([]byte{0x00}, k.key...)
+	} else {
+		data = EncodePublicKey(&ecdsaKey(k.key).PublicKey)
+	}
+	data = appendIndex(data, index)
+
+	parent := new(big.Int).SetBytes(k.key)
+	for {
+		mac := hmac.New(sha512.New, k.chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		il := new(big.Int).SetBytes(sum[:32])
+		if il.Cmp(n) < 0 {
+			il.Add(il, parent)
+			il.Mod(il, n)
+			if il.Sign() != 0 {
+				return &extendedKey{scalarBytes(il), sum[32:]}
+			}
+		}
+		data = appendIndex(append([]byte{0x01}, sum[32:]...), index)
+	}
+}
+
+func appendIndex(data []byte, index uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], index)
+	return append(data, buf[:]...)
+}
+
+func (k *extendedKey) derive(path []uint32) *extendedKey {
+	for _, index := range path {
+		k = k.child(index)
+	}
+	return k
+}
+
+func hdPath(account, chain, index uint32) []uint32 {
+	return []uint32{
+		HardenedKeyStart + hdPurpose,
+		HardenedKeyStart + hdCoinType,
+		HardenedKeyStart + account,
+		chain,
+		index,
+	}
+}
+
+// FormatPath writes a derivation path such as m/44'/1'/0'/0/3.
+func FormatPath(path []uint32) string {
+	parts := []string{"m"}
+	for _, index := range path {
+		if index >= HardenedKeyStart {
+			parts = append(parts, fmt.Sprintf("%d'", index-HardenedKeyStart))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d", index))
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// IsChange tells whether the wallet receives change, either because it was
+// derived on a change chain or generated for it.
+func (w *Wallet) IsChange() bool {
+	return w.Change || len(w.Path) == 5 && w.Path[3] == ChangeChain
+}
+
+func (ws *Wallets) HasHDChain() bool {
+	return ws.HD != nil
+}
+
+// NewHDChain creates the seed of the wallet and returns its mnemonic, which
+// is all that is needed to restore the derived keys.
+func (ws *Wallets) NewHDChain() (string, error) {
+	entropy, err := bip39.NewEntropy(mnemonicEntropyBits)
+	if err != nil {
+		return "", err
+	}
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return "", err
+	}
+	if err := ws.setHDChain(mnemonic); err != nil {
+		return "", err
+	}
+	return mnemonic, nil
+}
+
+func (ws *Wallets) setHDChain(mnemonic string) error {
+	if ws.HasHDChain() {
+		return errors.New("wallet already has a seed")
+	}
+	if ws.IsLocked() {
+		return ErrWalletLocked
+	}
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return errors.New("mnemonic is not valid")
+	}
+
+	hd := &HDChain{Mnemonic: mnemonic, Next: make(map[uint32][]uint32)}
+	if ws.IsEncrypted() {
+		if err := hd.encrypt(ws.masterKey); err != nil {
+			return err
+		}
+	}
+	ws.HD = hd
+	return nil
+}
+
+func (ws *Wallets) masterExtendedKey() (*extendedKey, error) {
+	if !ws.HasHDChain() {
+		return nil, errors.New("wallet has no seed, create one with createwallet")
+	}
+	if ws.HD.Mnemonic == "" {
+		return nil, ErrWalletLocked
+	}
+	seed, err := bip39.NewSeedWithErrorChecking(ws.HD.Mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+	return newMasterKey(seed), nil
+}
+
+// deriveWallet returns the P-256 key at the given position of the seed.
+func deriveWallet(master *extendedKey, account, chain, index uint32) *Wallet {
+	path := hdPath(account, chain, index)
+	key := master.derive(path)
+	publicKey := EncodePublicKey(&ecdsaKey(key.key).PublicKey)
+	return &Wallet{Type: P256, PrivateKey: key.key, PublicKey: publicKey, Path: path}
+}
+
+// NextAddress derives the next unused key of the chain in the account.
+func (ws *Wallets) NextAddress(account, chain uint32) (string, error) {
+	if account >= HardenedKeyStart || chain > ChangeChain {
+		return "", fmt.Errorf("no chain %d in account %d", chain, account)
+	}
+	master, err := ws.masterExtendedKey()
+	if err != nil {
+		return "", err
+	}
+
+	next, ok := ws.HD.Next[account]
+	if !ok {
+		next = []uint32{0, 0}
+		ws.HD.Next[account] = next
+	}
+
+	w := deriveWallet(master, account, chain, next[chain])
+	next[chain]++
+	return ws.insert(w)
+}
+
+// RestoreHDChain sets the seed from a mnemonic and derives the keys that
+// have been used, as told by isUsed. Each chain is scanned until gapLimit
+// unused keys follow the last used one, and accounts are scanned until one
+// is found with no used key at all. It returns the number of keys added.
+func (ws *Wallets) RestoreHDChain(mnemonic string, isUsed func(pubKeyHash []byte) bool, gapLimit int) (int, error) {
+	if gapLimit < 1 {
+		return 0, errors.New("gap limit must be at least 1")
+	}
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	if err := ws.setHDChain(mnemonic); err != nil {
+		return 0, err
+	}
+	master, err := ws.masterExtendedKey()
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for account := uint32(0); account < HardenedKeyStart; account++ {
+		next := []uint32{0, 0}
+
+		for _, chain := range []uint32{ExternalChain, ChangeChain} {
+			var found []*Wallet
+			for index, gap := uint32(0), 0; gap < gapLimit; index++ {
+				w := deriveWallet(master, account, chain, index)
+				found = append(found, w)
+				if isUsed(PublicKeyHash(w.PublicKey)) {
+					next[chain] = index + 1
+					gap = 0
+				} else {
+					gap++
+				}
+			}
+
+			for _, w := range found[:next[chain]] {
+				if _, err := ws.insert(w); err != nil {
+					return restored, err
+				}
+				restored++
+			}
+		}
+
+		unused := next[ExternalChain] == 0 && next[ChangeChain] == 0
+		if !unused || account == 0 {
+			ws.HD.Next[account] = next
+		}
+		if unused {
+			break
+		}
+	}
+	return restored, nil
+}
+
+func (hd *HDChain) encrypt(masterKey []byte) error {
+	sealed, err := seal(masterKey, []byte(hd.Mnemonic), []byte("mnemonic"))
+	if err != nil {
+		return err
+	}
+	hd.EncryptedMnemonic = sealed
+	return nil
+}
+
+func (hd *HDChain) decrypt(masterKey []byte) error {
+	mnemonic, err := unseal(masterKey, hd.EncryptedMnemonic, []byte("mnemonic"))
+	if err != nil {
+		return err
+	}
+	hd.Mnemonic = string(mnemonic)
+	return nil
+}
@@ -0,0 +1,81 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+const hardened = HardenedKeyStart
+
+// The nist256p1 test vectors of SLIP 10: the chain code and private key of
+// each key along the path from the seed.
+var slip10Vectors = []struct {
+	seed string
+	path []uint32
+	keys [][2]string
+}{
+	{
+		seed: "000102030405060708090a0b0c0d0e0f",
+		path: []uint32{hardened + 0, 1, hardened + 2, 2, 1000000000},
+		keys: [][2]string{
+			{"beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+			{"3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11", "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+			{"4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c", "284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129"},
+			{"98c7514f562e64e74170cc3cf304ee1ce54d6b6da4f880f313e8204c2a185318", "694596e8a54f252c960eb771a3c41e7e32496d03b954aeb90f61635b8e092aa7"},
+			{"ba96f776a5c3907d7fd48bde5620ee374d4acfd540378476019eab70790c63a0", "5996c37fd3dd2679039b23ed6f70b506c6b56b3cb5e424681fb0fa64caf82aaa"},
+			{"b9b7b82d326bb9cb5b5b121066feea4eb93d5241103c9e7a18aad40f1dde8059", "21c4f269ef0a5fd1badf47eeacebeeaa3de22eb8e5b0adcd0f27dd99d34d0119"},
+		},
+	},
+	{
+		seed: "fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542",
+		path: []uint32{0, hardened + 2147483647, 1, hardened + 2147483646, 2},
+		keys: [][2]string{
+			{"96cd4465a9644e31528eda3592aa35eb39a9527769ce1855beafc1b81055e75d", "eaa31c2e46ca2962227cf21d73a7ef0ce8b31c756897521eb6c7b39796633357"},
+			{"84e9c258bb8557a40e0d041115b376dd55eda99c0042ce29e81ebe4efed9b86a", "d7d065f63a62624888500cdb4f88b6d59c2927fee9e6d0cdff9cad555884df6e"},
+			{"f235b2bc5c04606ca9c30027a84f353acf4e4683edbd11f635d0dcc1cd106ea6", "96d2ec9316746a75e7793684ed01e3d51194d81a42a3276858a5b7376d4b94b9"},
+			{"7c0b833106235e452eba79d2bdd58d4086e663bc8cc55e9773d2b5eeda313f3b", "974f9096ea6873a915910e82b29d7c338542ccde39d2064d1cc228f371542bbc"},
+			{"5794e616eadaf33413aa309318a26ee0fd5163b70466de7a4512fd4b1a5c9e6a", "da29649bbfaff095cd43819eda9a7be74236539a29094cd8336b07ed8d4eff63"},
+			{"3bfb29ee8ac4484f09db09c2079b520ea5616df7820f071a20320366fbe226a7", "bb0a77ba01cc31d77205d51d08bd313b979a71ef4de9b062f8958297e746bd67"},
+		},
+	},
+	// The child key of m/28578' has to be derived again.
+	{
+		seed: "000102030405060708090a0b0c0d0e0f",
+		path: []uint32{hardened + 28578, 33941},
+		keys: [][2]string{
+			{"beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+			{"e94c8ebe30c2250a14713212f6449b20f3329105ea15b652ca5bdfc68f6c65c2", "06f0db126f023755d0b8d86d4591718a5210dd8d024e3e14b6159d63f53aa669"},
+			{"9e87fe95031f14736774cd82f25fd885065cb7c358c1edf813c72af535e83071", "092154eed4af83e078ff9b84322015aefe5769e31270f62c3f66c33888335f3a"},
+		},
+	},
+	// The master key of this seed has to be derived again.
+	{
+		seed: "a7305bc8df8d0951f0cb224c0e95d7707cbdf2c6ce7e8d481fec69c7ff5e9446",
+		keys: [][2]string{
+			{"7762f9729fed06121fd13f326884c82f59aa95c57ac492ce8c9654e60efd130c", "3b8c18469a4634517d6d0b65448f8e6c62091b45540a1743c5846be55d47d88f"},
+		},
+	},
+}
+
+func TestSLIP10Vectors(t *testing.T) {
+	for _, vector := range slip10Vectors {
+		seed, err := hex.DecodeString(vector.seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		k := newMasterKey(seed)
+		for i, want := range vector.keys {
+			name := FormatPath(vector.path[:i])
+			if i > 0 {
+				k = k.child(vector.path[i-1])
+			}
+			if got := hex.EncodeToString(k.chainCode); got != want[0] {
+				t.Errorf("%s of %s: chain code is %s, want %s", name, vector.seed, got, want[0])
+			}
+			if got := hex.EncodeToString(k.key); got != want[1] {
+				t.Errorf("%s of %s: private key is %s, want %s", name, vector.seed, got, want[1])
+			}
+		}
+	}
+}
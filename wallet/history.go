@@ -0,0 +1,252 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+)
+
+const historyFile = "./tmp/history_%s.data"
+
+// Direction tells how a transaction moved coins of the wallet.
+type Direction string
+
+const (
+	Received  Direction = "received"
+	Sent      Direction = "sent"
+	Self      Direction = "self"
+	Generated Direction = "generated"
+)
+
+// WalletTx is a transaction of the wallet as the wallet sees it. Amounts
+// are in base units.
+type WalletTx struct {
+	TxID      []byte
+	Direction Direction
+
+	// Address is the counterparty: the address paid by a payment, or the
+	// address of the wallet that received. It is empty when the payee is
+	// only known by PubKeyHash, since a public key hash does not tell which
+	// kind of address it belongs to.
+	Address    string
+	PubKeyHash []byte
+
+	// Recipients counts the outside addresses a payment paid. A payment
+	// to more than one has no counterparty.
+	Recipients int
+
+	// Addresses are the addresses of the wallet the transaction spent from
+	// or paid to.
+	Addresses []string
+
+	// Amount is what left the wallet for a payment, what arrived otherwise.
+	// Fee is only known for transactions the wallet paid.
+	Amount int64
+	Fee    int64
+
+	// Height of the block holding the transaction, -1 while unconfirmed.
+	Height int
+	Time   int64
+
+	Label string
+	Note  string
+}
+
+func (tx *WalletTx) IsConfirmed() bool {
+	return tx.Height >= 0
+}
+
+// Confirmations counts the blocks on top of the transaction's, its own
+// included, when the best block is at bestHeight.
+func (tx *WalletTx) Confirmations(bestHeight int) int {
+	if !tx.IsConfirmed() {
+		return 0
+	}
+	return bestHeight - tx.Height + 1
+}
+
+// Involves tells whether the transaction paid or spent from address.
+func (tx *WalletTx) Involves(address string) bool {
+	if tx.Address == address {
+		return true
+	}
+	for _, a := range tx.Addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// History holds the transactions of the wallet, kept up to date by scanning
+// the blocks connected since the last scan.
+type History struct {
+	Txs map[string]*WalletTx
+
+	// ScannedHash is the last block scanned and ScannedKeys how many
+	// addresses the wallet had then. Adding an address needs a rescan.
+	ScannedHash []byte
+	ScannedKeys int
+}
+
+// SaveHistory writes the history to its own file. Keeping it out of the
+// wallet file means the node, which scans every block it connects, never
+// saves over keys added by a command in the meantime.
+func (ws *Wallets) SaveHistory(nodeId string) {
+	var content bytes.Buffer
+
+	err := gob.NewEncoder(&content).Encode(ws.history())
+	if err != nil {
+		log.Panic(err)
+	}
+
+	err = writePrivateFile(fmt.Sprintf(historyFile, nodeId), content.Bytes())
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// loadHistory reads the history file. A history found in the wallet file
+// instead is moved to its own file, and one that can not be read is left to
+// the next scan to rebuild.
+func (ws *Wallets) loadHistory(nodeId string) {
+	data, err := ioutil.ReadFile(fmt.Sprintf(historyFile, nodeId))
+	if os.IsNotExist(err) && ws.History != nil {
+		ws.SaveHistory(nodeId)
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var h History
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&h); err != nil || h.Txs == nil {
+		ws.History = nil
+		return
+	}
+	ws.History = &h
+}
+
+func (ws *Wallets) history() *History {
+	if ws.History == nil {
+		ws.History = &History{Txs: make(map[string]*WalletTx)}
+	}
+	return ws.History
+}
+
+// OwnPubKeyHashes maps the public key hash of every address of the wallet,
+// watch-only ones included, to its address.
+func (ws *Wallets) OwnPubKeyHashes() map[string]string {
+	owned := make(map[string]string)
+	for address, w := range ws.Wallets {
+		owned[hex.EncodeToString(PublicKeyHash(w.PublicKey))] = address
+	}
+	for address, w := range ws.WatchOnly {
+		owned[hex.EncodeToString(w.PubKeyHash)] = address
+	}
+	return owned
+}
+
+// ScannedHash returns the last block the history was scanned up to, or nil
+// if it has to be rebuilt from the first block, because it was never
+// scanned or addresses were added since.
+func (ws *Wallets) ScannedHash() []byte {
+	h := ws.history()
+	if h.ScannedKeys != len(ws.OwnPubKeyHashes()) {
+		return nil
+	}
+	return h.ScannedHash
+}
+
+// ResetHistory forgets where the history was scanned up to and marks every
+// transaction unconfirmed until the rescan finds it again.
+func (ws *Wallets) ResetHistory() {
+	h := ws.history()
+	h.ScannedHash = nil
+	for _, tx := range h.Txs {
+		tx.Height = -1
+	}
+}
+
+// RecordTx adds a transaction found by a scan, or updates the one in the
+// history. Labels, notes and a known counterparty address are kept.
+func (ws *Wallets) RecordTx(tx *WalletTx) {
+	h := ws.history()
+	id := hex.EncodeToString(tx.TxID)
+
+	if old, ok := h.Txs[id]; ok {
+		tx.Label, tx.Note = old.Label, old.Note
+		if tx.Address == "" {
+			tx.Address = old.Address
+		}
+		if !tx.IsConfirmed() && old.Time != 0 {
+			tx.Time = old.Time
+		}
+	}
+	h.Txs[id] = tx
+}
+
+// FinishScan records the block a scan reached and drops the unconfirmed
+// transactions that are not pending anymore, such as replaced ones.
+func (ws *Wallets) FinishScan(tip []byte, isPending func(txID []byte) bool) {
+	h := ws.history()
+	h.ScannedHash = tip
+	h.ScannedKeys = len(ws.OwnPubKeyHashes())
+
+	for id, tx := range h.Txs {
+		if !tx.IsConfirmed() && !isPending(tx.TxID) {
+			delete(h.Txs, id)
+		}
+	}
+}
+
+// SetCounterparty remembers the address a payment was made to, which the
+// scan can not tell from the outputs alone.
+func (ws *Wallets) SetCounterparty(txID []byte, address string) {
+	h := ws.history()
+	id := hex.EncodeToString(txID)
+	if tx, ok := h.Txs[id]; ok {
+		tx.Address = address
+		return
+	}
+	h.Txs[id] = &WalletTx{TxID: txID, Direction: Sent, Address: address, Height: -1}
+}
+
+// LabelTx sets the label and note of a transaction of the history. It
+// reports false if the wallet has no such transaction.
+func (ws *Wallets) LabelTx(txID []byte, label, note string) bool {
+	tx, ok := ws.history().Txs[hex.EncodeToString(txID)]
+	if !ok {
+		return false
+	}
+	tx.Label, tx.Note = label, note
+	return true
+}
+
+// Transactions returns the history oldest first, unconfirmed transactions
+// last.
+func (ws *Wallets) Transactions() []*WalletTx {
+	var txs []*WalletTx
+	for _, tx := range ws.history().Txs {
+		txs = append(txs, tx)
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		a, b := txs[i], txs[j]
+		if a.IsConfirmed() != b.IsConfirmed() {
+			return a.IsConfirmed()
+		}
+		if a.Height != b.Height {
+			return a.Height < b.Height
+		}
+		if a.Time != b.Time {
+			return a.Time < b.Time
+		}
+		return hex.EncodeToString(a.TxID) < hex.EncodeToString(b.TxID)
+	})
+	return txs
+}
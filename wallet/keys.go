@@ -0,0 +1,168 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// KeyType selects the signature scheme of a wallet. It doubles as the
+// version byte of the wallet's addresses.
+type KeyType byte
+
+const (
+	// P256 is ECDSA on NIST P-256, the original key type. Its version byte
+	// is 0x00, so addresses created before key types existed keep working.
+	P256 KeyType = iota
+	Ed25519
+	// Schnorr signs with Schnorr signatures over P-256.
+	Schnorr
+)
+
+// typedKeyFlag is set on the first byte of public keys of the newer types.
+// Compressed P-256 keys start with 0x02 or 0x03, so the two can never be
+// confused and the key type is committed to by the public key hash.
+const typedKeyFlag = 0x80
+
+func ParseKeyType(name string) (KeyType, error) {
+	switch strings.ToLower(name) {
+	case "p256", "ecdsa":
+		return P256, nil
+	case "ed25519":
+		return Ed25519, nil
+	case "schnorr":
+		return Schnorr, nil
+	}
+	return 0, fmt.Errorf("unknown key type %q", name)
+}
+
+func (t KeyType) String() string {
+	switch t {
+	case P256:
+		return "p256"
+	case Ed25519:
+		return "ed25519"
+	case Schnorr:
+		return "schnorr"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(t))
+}
+
+func (t KeyType) IsValid() bool {
+	return t == P256 || t == Ed25519 || t == Schnorr
+}
+
+// Version is the address version byte of the key type.
+func (t KeyType) Version() byte {
+	return byte(t)
+}
+
+// PublicKeyType tells which key type a public key belongs to and makes sure
+// it has the length of that type.
+func PublicKeyType(publicKey []byte) (KeyType, error) {
+	if len(publicKey) == 0 {
+		return 0, errors.New("public key is empty")
+	}
+	if isLegacyPublicKey(publicKey) {
+		return P256, nil
+	}
+
+	switch publicKey[0] {
+	case 0x02, 0x03:
+		if len(publicKey) == PublicKeyLength {
+			return P256, nil
+		}
+	case typedKeyFlag | byte(Ed25519):
+		if len(publicKey) == 1+ed25519.PublicKeySize {
+			return Ed25519, nil
+		}
+	case typedKeyFlag | byte(Schnorr):
+		if len(publicKey) == 1+PublicKeyLength {
+			return Schnorr, nil
+		}
+	}
+	return 0, errors.New("public key has an unknown encoding")
+}
+
+// newKeyPair returns the raw private key and the encoded public key for a new
+// key of type t.
+func newKeyPair(t KeyType) ([]byte, []byte, error) {
+	switch t {
+	case P256:
+		private, public := NewKeyPair()
+		return scalarBytes(private.D), public, nil
+	case Ed25519:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return private.Seed(), append([]byte{typedKeyFlag | byte(t)}, public...), nil
+	case Schnorr:
+		private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		public := append([]byte{typedKeyFlag | byte(t)}, EncodePublicKey(&private.PublicKey)...)
+		return scalarBytes(private.D), public, nil
+	}
+	return nil, nil, fmt.Errorf("unknown key type %d", t)
+}
+
+func scalarBytes(d *big.Int) []byte {
+	return d.FillBytes(make([]byte, scalarLength))
+}
+
+// ecdsaKey rebuilds a P-256 key from its private scalar.
+func ecdsaKey(d []byte) *ecdsa.PrivateKey {
+	curve := elliptic.P256()
+	private := new(ecdsa.PrivateKey)
+	private.Curve = curve
+	private.D = new(big.Int).SetBytes(d)
+	private.X, private.Y = curve.ScalarBaseMult(d)
+	return private
+}
+
+// Sign signs a digest with the wallet's key, using the scheme of its type.
+func (w *Wallet) Sign(digest []byte) ([]byte, error) {
+	if len(w.PrivateKey) == 0 {
+		return nil, ErrWalletLocked
+	}
+
+	switch w.Type {
+	case P256:
+		return SignDigest(ecdsaKey(w.PrivateKey), digest)
+	case Ed25519:
+		return ed25519.Sign(ed25519.NewKeyFromSeed(w.PrivateKey), digest), nil
+	case Schnorr:
+		return signSchnorr(w.PrivateKey, digest)
+	}
+	return nil, fmt.Errorf("unknown key type %d", w.Type)
+}
+
+// VerifySignature checks a signature against an encoded public key, using
+// the scheme the key belongs to. Non-canonical encodings are rejected.
+func VerifySignature(publicKey, digest, signature []byte) bool {
+	if len(signature) != SignatureLength {
+		return false
+	}
+
+	keyType, err := PublicKeyType(publicKey)
+	if err != nil {
+		return false
+	}
+
+	switch keyType {
+	case P256:
+		return verifyECDSA(publicKey, digest, signature)
+	case Ed25519:
+		return ed25519.Verify(ed25519.PublicKey(publicKey[1:]), digest, signature)
+	case Schnorr:
+		return verifySchnorr(publicKey[1:], digest, signature)
+	}
+	return false
+}
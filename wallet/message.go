@@ -0,0 +1,131 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+)
+
+// Messages are signed under their own tagged hash, so a signed message can
+// never be passed off as a signed transaction or the other way around.
+const messageTag = "tualatin/message"
+
+// recoverableSignatureLength is the size of a P-256 message signature: a
+// recovery id followed by R and S. Signatures of the other key types carry
+// their public key instead, which can not be recovered from them.
+const recoverableSignatureLength = 1 + SignatureLength
+
+// MessageHash is the digest signed by SignMessage: the message hashed under
+// messageTag, so it never equals the digest of a transaction.
+func MessageHash(message string) []byte {
+	return taggedHash(messageTag, []byte(message))
+}
+
+// SignMessage signs a message so that VerifyMessage can check it knowing
+// only the address of the wallet.
+func (w *Wallet) SignMessage(message string) ([]byte, error) {
+	digest := MessageHash(message)
+	signature, err := w.Sign(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.Type != P256 {
+		return append(append([]byte{}, w.PublicKey...), signature...), nil
+	}
+
+	publicKey := w.PublicKey
+	if isLegacyPublicKey(publicKey) {
+		key, err := DecodePublicKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		publicKey = EncodePublicKey(key)
+	}
+	for recoveryId := byte(0); recoveryId < 4; recoveryId++ {
+		if bytes.Equal(recoverPublicKey(digest, recoveryId, signature), publicKey) {
+			return append([]byte{recoveryId}, signature...), nil
+		}
+	}
+	return nil, errors.New("could not find the recovery id of the signature")
+}
+
+// VerifyMessage checks that a message was signed by the key behind address.
+func VerifyMessage(address string, signature []byte, message string) bool {
+	pubKeyHash, err := PubKeyHashOf(address)
+	if err != nil || len(signature) < recoverableSignatureLength {
+		return false
+	}
+	digest := MessageHash(message)
+
+	var publicKey []byte
+	if len(signature) == recoverableSignatureLength {
+		publicKey = recoverPublicKey(digest, signature[0], signature[1:])
+		signature = signature[1:]
+
+		// Addresses of keys made before keys were compressed hash the
+		// bare X and Y instead.
+		if publicKey != nil && !bytes.Equal(PublicKeyHash(publicKey), pubKeyHash) {
+			publicKey = legacyPublicKey(publicKey)
+		}
+	} else {
+		split := len(signature) - SignatureLength
+		publicKey, signature = signature[:split], signature[split:]
+	}
+
+	if publicKey == nil || !bytes.Equal(PublicKeyHash(publicKey), pubKeyHash) {
+		return false
+	}
+	return VerifySignature(publicKey, digest, signature)
+}
+
+// recoverPublicKey finds the P-256 key that made an ECDSA signature of
+// digest. The recovery id picks which of the up to four candidate nonce
+// points was used: its low bit is the parity of Y and its high bit tells
+// whether X overflowed the curve order. It returns nil if there is no key.
+func recoverPublicKey(digest []byte, recoveryId byte, signature []byte) []byte {
+	curve := elliptic.P256()
+	params := curve.Params()
+	n := params.N
+
+	if recoveryId > 3 || len(signature) != SignatureLength {
+		return nil
+	}
+	r := new(big.Int).SetBytes(signature[:scalarLength])
+	s := new(big.Int).SetBytes(signature[scalarLength:])
+	if r.Sign() == 0 || r.Cmp(n) >= 0 || s.Sign() == 0 || s.Cmp(n) >= 0 {
+		return nil
+	}
+
+	x := new(big.Int).Set(r)
+	if recoveryId&2 != 0 {
+		x.Add(x, n)
+	}
+	if x.Cmp(params.P) >= 0 {
+		return nil
+	}
+	point := append([]byte{0x02 | recoveryId&1}, x.FillBytes(make([]byte, scalarLength))...)
+	rx, ry := elliptic.UnmarshalCompressed(curve, point)
+	if rx == nil {
+		return nil
+	}
+
+	// Q = r^-1 * (s*R - e*G)
+	rInv := new(big.Int).ModInverse(r, n)
+	e := bitsToInt(digest, n.BitLen())
+	e.Mod(e, n)
+
+	u1 := new(big.Int).Mul(s, rInv)
+	u1.Mod(u1, n)
+	u2 := new(big.Int).Mul(new(big.Int).Sub(n, e), rInv)
+	u2.Mod(u2, n)
+
+	x1, y1 := curve.ScalarMult(rx, ry, u1.FillBytes(make([]byte, scalarLength)))
+	x2, y2 := curve.ScalarBaseMult(u2.FillBytes(make([]byte, scalarLength)))
+	qx, qy := curve.Add(x1, y1, x2, y2)
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil
+	}
+	return elliptic.MarshalCompressed(curve, qx, qy)
+}
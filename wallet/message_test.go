@@ -0,0 +1,77 @@
+package wallet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSignMessage(t *testing.T) {
+	other := MakeWallet()
+
+	for _, keyType := range []KeyType{P256, Ed25519, Schnorr} {
+		w, err := MakeWalletOfType(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		address := string(w.Address())
+
+		signature, err := w.SignMessage("hello")
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		if !VerifyMessage(address, signature, "hello") {
+			t.Errorf("%s: signature does not verify", keyType)
+		}
+		if VerifyMessage(string(other.Address()), signature, "hello") {
+			t.Errorf("%s: signature verifies for another address", keyType)
+		}
+		if VerifyMessage(address, signature, "hello!") {
+			t.Errorf("%s: signature verifies for a tampered message", keyType)
+		}
+
+		tampered := append([]byte{}, signature...)
+		tampered[len(tampered)-1] ^= 1
+		if VerifyMessage(address, tampered, "hello") {
+			t.Errorf("%s: tampered signature verifies", keyType)
+		}
+	}
+}
+
+// P-256 signatures leave out the public key, which is recovered from them.
+func TestSignMessageRecoversKey(t *testing.T) {
+	w := MakeWallet()
+
+	signature, err := w.SignMessage("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signature) != recoverableSignatureLength {
+		t.Fatalf("signature is %d bytes, want %d", len(signature), recoverableSignatureLength)
+	}
+	digest := MessageHash("hello")
+	if key := recoverPublicKey(digest, signature[0], signature[1:]); !bytes.Equal(key, w.PublicKey) {
+		t.Errorf("recovered key %x, want %x", key, w.PublicKey)
+	}
+}
+
+// Wallets made before keys were compressed have addresses of the bare X
+// and Y of their key.
+func TestSignMessageLegacyKey(t *testing.T) {
+	w := MakeWallet()
+	w.PublicKey = legacyPublicKey(w.PublicKey)
+	address := string(w.Address())
+
+	signature, err := w.SignMessage("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyMessage(address, signature, "hello") {
+		t.Error("signature does not verify")
+	}
+	if VerifyMessage(address, signature, "hello!") {
+		t.Error("signature verifies for a tampered message")
+	}
+	if VerifyMessage(string(MakeWallet().Address()), signature, "hello") {
+		t.Error("signature verifies for another address")
+	}
+}
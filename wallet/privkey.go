@@ -0,0 +1,95 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/mr-tron/base58"
+)
+
+// Private keys are exported as Base58 text with a checksum, in the manner of
+// Bitcoin's wallet import format: a version byte, the key type, the raw
+// private key and the first bytes of its double SHA-256.
+
+const privateKeyVersion = byte(0x80)
+
+// legacyKeyFlag follows the private key of a P-256 wallet made before keys
+// were compressed, much as WIF marks compressed keys with a trailing 0x01.
+// Its address hashes the bare X and Y, so that encoding is rebuilt on import.
+const legacyKeyFlag = byte(0x00)
+
+// EncodePrivateKey returns the portable text form of the wallet's key.
+func EncodePrivateKey(w *Wallet) (string, error) {
+	if len(w.PrivateKey) == 0 {
+		return "", ErrWalletLocked
+	}
+
+	payload := append([]byte{privateKeyVersion, byte(w.Type)}, w.PrivateKey...)
+	if w.Type == P256 && isLegacyPublicKey(w.PublicKey) {
+		payload = append(payload, legacyKeyFlag)
+	}
+	payload = append(payload, Checksum(payload)...)
+	return string(Base58Encode(payload)), nil
+}
+
+// DecodePrivateKey reads a key written by EncodePrivateKey and rebuilds the
+// wallet around it.
+func DecodePrivateKey(text string) (*Wallet, error) {
+	payload, err := base58.Decode(text)
+	if err != nil || len(payload) < 2+ChecksumLength {
+		return nil, errors.New("private key is not Base58 text")
+	}
+
+	data, checksum := payload[:len(payload)-ChecksumLength], payload[len(payload)-ChecksumLength:]
+	if !bytes.Equal(Checksum(data), checksum) {
+		return nil, errors.New("private key checksum does not match")
+	}
+	if data[0] != privateKeyVersion {
+		return nil, fmt.Errorf("unknown private key version %d", data[0])
+	}
+
+	t, privateKey := KeyType(data[1]), data[2:]
+	legacy := len(privateKey) == scalarLength+1 && privateKey[scalarLength] == legacyKeyFlag
+	if legacy {
+		privateKey = privateKey[:scalarLength]
+	}
+
+	w, err := walletFromPrivateKey(t, privateKey)
+	if err != nil || !legacy {
+		return w, err
+	}
+	if t != P256 {
+		return nil, errors.New("only P-256 keys have a legacy public key")
+	}
+	w.PublicKey = legacyPublicKey(w.PublicKey)
+	return w, nil
+}
+
+// walletFromPrivateKey derives the public key of a raw private key.
+func walletFromPrivateKey(t KeyType, privateKey []byte) (*Wallet, error) {
+	if len(privateKey) != scalarLength {
+		return nil, errors.New("private key has the wrong length")
+	}
+	privateKey = append([]byte{}, privateKey...)
+
+	switch t {
+	case P256, Schnorr:
+		d := new(big.Int).SetBytes(privateKey)
+		if d.Sign() == 0 || d.Cmp(elliptic.P256().Params().N) >= 0 {
+			return nil, errors.New("private key is out of range")
+		}
+		publicKey := EncodePublicKey(&ecdsaKey(privateKey).PublicKey)
+		if t == Schnorr {
+			publicKey = append([]byte{typedKeyFlag | byte(t)}, publicKey...)
+		}
+		return &Wallet{Type: t, PrivateKey: privateKey, PublicKey: publicKey}, nil
+	case Ed25519:
+		publicKey := ed25519.NewKeyFromSeed(privateKey).Public().(ed25519.PublicKey)
+		return &Wallet{Type: t, PrivateKey: privateKey, PublicKey: append([]byte{typedKeyFlag | byte(t)}, publicKey...)}, nil
+	}
+	return nil, fmt.Errorf("unknown key type %d", t)
+}
@@ -0,0 +1,57 @@
+package wallet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrivateKeyRoundTrip(t *testing.T) {
+	for _, keyType := range []KeyType{P256, Ed25519, Schnorr} {
+		w, err := MakeWalletOfType(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPrivateKeyRoundTrip(t, keyType.String(), w)
+	}
+}
+
+// Wallets made before keys were compressed keep the bare X and Y, which
+// their address hashes, when their key is exported and imported again. A
+// coordinate with a leading zero byte leaves the key shorter than 64 bytes.
+func TestPrivateKeyLegacyKey(t *testing.T) {
+	w := MakeWallet()
+	w.PublicKey = legacyPublicKey(w.PublicKey)
+	checkPrivateKeyRoundTrip(t, "legacy", w)
+
+	for i := 0; i < 10000; i++ {
+		w := MakeWallet()
+		w.PublicKey = legacyPublicKey(w.PublicKey)
+		if len(w.PublicKey) < legacyPublicKeyLength {
+			checkPrivateKeyRoundTrip(t, "short legacy", w)
+			return
+		}
+	}
+	t.Error("found no legacy key with a short coordinate")
+}
+
+func checkPrivateKeyRoundTrip(t *testing.T, name string, w *Wallet) {
+	t.Helper()
+
+	text, err := EncodePrivateKey(w)
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	imported, err := DecodePrivateKey(text)
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	if imported.Type != w.Type || !bytes.Equal(imported.PrivateKey, w.PrivateKey) {
+		t.Errorf("%s: imported a different key", name)
+	}
+	if !bytes.Equal(imported.PublicKey, w.PublicKey) {
+		t.Errorf("%s: imported public key %x, want %x", name, imported.PublicKey, w.PublicKey)
+	}
+	if string(imported.Address()) != string(w.Address()) {
+		t.Errorf("%s: imported address %s, want %s", name, imported.Address(), w.Address())
+	}
+}
@@ -0,0 +1,88 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// DeterministicSignatures makes SignDigest derive its nonce from the key and
+// the digest as described in RFC 6979, so signing the same transaction twice
+// gives the same bytes and a weak random source cannot leak the key. Tests
+// that want fresh random nonces can switch it off.
+var DeterministicSignatures = true
+
+// signDeterministic implements RFC 6979 section 3.2 with HMAC-SHA256.
+func signDeterministic(privateKey *ecdsa.PrivateKey, digest []byte) (*big.Int, *big.Int, error) {
+	curve := privateKey.Curve
+	n := curve.Params().N
+	qlen := n.BitLen()
+	rlen := (qlen + 7) / 8
+
+	x := make([]byte, rlen)
+	privateKey.D.FillBytes(x)
+
+	e := bitsToInt(digest, qlen)
+	h := make([]byte, rlen)
+	new(big.Int).Mod(e, n).FillBytes(h)
+
+	v := make([]byte, sha256.Size)
+	for i := range v {
+		v[i] = 0x01
+	}
+	k := make([]byte, sha256.Size)
+
+	k = mac(k, v, []byte{0x00}, x, h)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, x, h)
+	v = mac(k, v)
+
+	for attempt := 0; attempt < 100; attempt++ {
+		var t []byte
+		for len(t) < rlen {
+			v = mac(k, v)
+			t = append(t, v...)
+		}
+
+		nonce := bitsToInt(t, qlen)
+		if nonce.Sign() > 0 && nonce.Cmp(n) < 0 {
+			rx, _ := curve.ScalarBaseMult(nonce.Bytes())
+			r := new(big.Int).Mod(rx, n)
+
+			if r.Sign() != 0 {
+				s := new(big.Int).Mul(r, privateKey.D)
+				s.Add(s, e)
+				s.Mul(s, new(big.Int).ModInverse(nonce, n))
+				s.Mod(s, n)
+
+				if s.Sign() != 0 {
+					return r, s, nil
+				}
+			}
+		}
+
+		k = mac(k, v, []byte{0x00})
+		v = mac(k, v)
+	}
+	return nil, nil, errors.New("could not derive a signing nonce")
+}
+
+func mac(key []byte, parts ...[]byte) []byte {
+	hasher := hmac.New(sha256.New, key)
+	for _, part := range parts {
+		hasher.Write(part)
+	}
+	return hasher.Sum(nil)
+}
+
+// bitsToInt keeps the leftmost qlen bits of data, as ECDSA does with digests
+// longer than the curve order.
+func bitsToInt(data []byte, qlen int) *big.Int {
+	v := new(big.Int).SetBytes(data)
+	if excess := len(data)*8 - qlen; excess > 0 {
+		v.Rsh(v, uint(excess))
+	}
+	return v
+}
@@ -0,0 +1,96 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// The P-256 key of RFC 6979 appendix A.2.5.
+const (
+	rfc6979Key = "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721"
+	rfc6979Ux  = "60FED4BA255A9D31C961EB74C6356D68C049B8923B61FA6CE669622E60F29FB6"
+	rfc6979Uy  = "7903FE1008B8BC99A41AE9E95628BC64F2F1B20C2D7E9F5177A3C294D4462299"
+)
+
+// The SHA-256 signatures of RFC 6979 appendix A.2.5.
+var rfc6979Vectors = []struct {
+	message string
+	r, s    string
+}{
+	{
+		message: "sample",
+		r:       "EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+		s:       "F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+	},
+	{
+		message: "test",
+		r:       "F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+		s:       "019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+	},
+}
+
+func hexInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("bad hex %s", s)
+	}
+	return v
+}
+
+func TestRFC6979KeyPair(t *testing.T) {
+	key := ecdsaKey(hexInt(t, rfc6979Key).Bytes())
+
+	if key.X.Cmp(hexInt(t, rfc6979Ux)) != 0 || key.Y.Cmp(hexInt(t, rfc6979Uy)) != 0 {
+		t.Fatalf("public key is (%X, %X)", key.X, key.Y)
+	}
+}
+
+func TestRFC6979Signatures(t *testing.T) {
+	key := ecdsaKey(hexInt(t, rfc6979Key).Bytes())
+
+	for _, v := range rfc6979Vectors {
+		digest := sha256.Sum256([]byte(v.message))
+
+		r, s, err := signDeterministic(key, digest[:])
+		if err != nil {
+			t.Fatalf("%s: %s", v.message, err)
+		}
+		if r.Cmp(hexInt(t, v.r)) != 0 || s.Cmp(hexInt(t, v.s)) != 0 {
+			t.Errorf("%s: signature is (%X, %X), want (%s, %s)", v.message, r, s, v.r, v.s)
+		}
+	}
+}
+
+// SignDigest gives the same signatures, with S moved to the lower half of
+// the curve order.
+func TestSignDigestDeterministic(t *testing.T) {
+	key := ecdsaKey(hexInt(t, rfc6979Key).Bytes())
+	n := key.Curve.Params().N
+
+	for _, v := range rfc6979Vectors {
+		digest := sha256.Sum256([]byte(v.message))
+
+		s := hexInt(t, v.s)
+		if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+			s.Sub(n, s)
+		}
+		want := make([]byte, SignatureLength)
+		hexInt(t, v.r).FillBytes(want[:scalarLength])
+		s.FillBytes(want[scalarLength:])
+
+		signature, err := SignDigest(key, digest[:])
+		if err != nil {
+			t.Fatalf("%s: %s", v.message, err)
+		}
+		if !bytes.Equal(signature, want) {
+			t.Errorf("%s: signature is %x, want %s", v.message, signature, hex.EncodeToString(want))
+		}
+		if !VerifySignature(EncodePublicKey(&key.PublicKey), digest[:], signature) {
+			t.Errorf("%s: signature does not verify", v.message)
+		}
+	}
+}
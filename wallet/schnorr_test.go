@@ -0,0 +1,39 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// The signature of "sample" under the RFC 6979 key. The nonce is derived
+// from the key and the message, so signing it must always give these bytes.
+const schnorrSampleSignature = "D89BBBE1BA4FACB37F3DAB42722E060C2BFCED7D560E69294100DDB072959C1D" +
+	"08C34101B9AC296591BE608548045A3B05DD9529743AB7391261BDE26A5AAC4A"
+
+func TestSchnorrVector(t *testing.T) {
+	key := hexInt(t, rfc6979Key).Bytes()
+	publicKey := EncodePublicKey(&ecdsaKey(key).PublicKey)
+	digest := sha256.Sum256([]byte("sample"))
+
+	signature, err := signSchnorr(key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.ToUpper(hex.EncodeToString(signature)); got != schnorrSampleSignature {
+		t.Fatalf("signature is %s, want %s", got, schnorrSampleSignature)
+	}
+	if !verifySchnorr(publicKey, digest[:], signature) {
+		t.Fatal("signature does not verify")
+	}
+
+	other := sha256.Sum256([]byte("test"))
+	if verifySchnorr(publicKey, other[:], signature) {
+		t.Error("signature verifies for another message")
+	}
+	signature[len(signature)-1] ^= 1
+	if verifySchnorr(publicKey, digest[:], signature) {
+		t.Error("changed signature verifies")
+	}
+}
@@ -0,0 +1,150 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+const (
+	// PublicKeyLength is the size of a compressed SEC1 public key: a 0x02 or
+	// 0x03 prefix for the parity of Y followed by the 32 byte X coordinate.
+	PublicKeyLength = 33
+
+	// SignatureLength is the size of a signature of every key type. ECDSA
+	// signatures are R and S, each left padded to 32 bytes.
+	SignatureLength = 64
+
+	scalarLength = 32
+)
+
+// EncodePublicKey returns the compressed SEC1 form of a public key.
+func EncodePublicKey(publicKey *ecdsa.PublicKey) []byte {
+	return elliptic.MarshalCompressed(publicKey.Curve, publicKey.X, publicKey.Y)
+}
+
+// Wallets made before keys were compressed encode their public key as the
+// bare X and Y coordinates without leading zero bytes, which is usually 64
+// bytes and rarely a byte or two less. Addresses of those keys hash that
+// encoding, so it is still accepted for spending.
+const (
+	legacyPublicKeyLength    = 2 * scalarLength
+	minLegacyPublicKeyLength = legacyPublicKeyLength - 2
+)
+
+// DecodePublicKey parses a compressed SEC1 public key. The uncompressed
+// SEC1 form and the legacy bare X and Y are accepted too, so that outputs
+// locked to keys made before keys were compressed can still be spent.
+// Points that are not on the curve are rejected.
+func DecodePublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+
+	var x, y *big.Int
+	switch {
+	case len(data) == PublicKeyLength && (data[0] == 0x02 || data[0] == 0x03):
+		x, y = elliptic.UnmarshalCompressed(curve, data)
+	case len(data) == 1+legacyPublicKeyLength && data[0] == 0x04:
+		x, y = elliptic.Unmarshal(curve, data)
+	case isLegacyPublicKey(data):
+		x, y = decodeBarePublicKey(curve, data)
+	default:
+		return nil, errors.New("public key has an unknown encoding")
+	}
+	if x == nil {
+		return nil, errors.New("public key is not on the curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// decodeBarePublicKey splits a legacy key into X and Y. A coordinate
+// shorter than 32 bytes leaves more than one way to split, but only one of
+// them gives a point on the curve.
+func decodeBarePublicKey(curve elliptic.Curve, data []byte) (*big.Int, *big.Int) {
+	for split := len(data) - scalarLength; split <= scalarLength; split++ {
+		if data[0] == 0 || data[split] == 0 {
+			continue
+		}
+		point := make([]byte, 1+legacyPublicKeyLength)
+		point[0] = 0x04
+		copy(point[1+scalarLength-split:], data[:split])
+		copy(point[1+legacyPublicKeyLength-(len(data)-split):], data[split:])
+
+		if x, y := elliptic.Unmarshal(curve, point); x != nil {
+			return x, y
+		}
+	}
+	return nil, nil
+}
+
+// isLegacyPublicKey tells whether a P-256 key is in one of the uncompressed
+// encodings.
+func isLegacyPublicKey(data []byte) bool {
+	if len(data) == 1+legacyPublicKeyLength {
+		return data[0] == 0x04
+	}
+	return len(data) >= minLegacyPublicKeyLength && len(data) <= legacyPublicKeyLength
+}
+
+// legacyPublicKey returns the bare X and Y of a compressed public key, the
+// encoding keys had before they were compressed, or nil if it is invalid.
+func legacyPublicKey(compressed []byte) []byte {
+	key, err := DecodePublicKey(compressed)
+	if err != nil {
+		return nil
+	}
+	return append(key.X.Bytes(), key.Y.Bytes()...)
+}
+
+// SignDigest signs a digest and returns R and S as fixed 32 byte values.
+// S is always taken from the lower half of the curve order, since both S and
+// N-S verify and allowing either would let anyone alter a signature.
+func SignDigest(privateKey *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	var r, s *big.Int
+	var err error
+
+	if DeterministicSignatures {
+		r, s, err = signDeterministic(privateKey, digest)
+	} else {
+		r, s, err = ecdsa.Sign(rand.Reader, privateKey, digest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return encodeSignature(privateKey.Curve, r, s), nil
+}
+
+func encodeSignature(curve elliptic.Curve, r, s *big.Int) []byte {
+	n := curve.Params().N
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s = new(big.Int).Sub(n, s)
+	}
+
+	signature := make([]byte, SignatureLength)
+	r.FillBytes(signature[:scalarLength])
+	s.FillBytes(signature[scalarLength:])
+	return signature
+}
+
+// verifyECDSA checks a signature made by SignDigest. Signatures and keys in
+// any other encoding, including a high S value, are rejected.
+func verifyECDSA(publicKey, digest, signature []byte) bool {
+	key, err := DecodePublicKey(publicKey)
+	if err != nil {
+		return false
+	}
+
+	n := key.Curve.Params().N
+	r := new(big.Int).SetBytes(signature[:scalarLength])
+	s := new(big.Int).SetBytes(signature[scalarLength:])
+
+	if r.Sign() == 0 || r.Cmp(n) >= 0 {
+		return false
+	}
+	if s.Sign() == 0 || s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		return false
+	}
+
+	return ecdsa.Verify(key, digest, r, s)
+}
@@ -0,0 +1,147 @@
+package wallet
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// ValidateVanityPrefix makes sure some P-256 address can start with prefix.
+// Their version byte is 0x00, so every one of them starts with 1.
+func ValidateVanityPrefix(prefix string) error {
+	if prefix == "" {
+		return fmt.Errorf("prefix is empty")
+	}
+	for _, c := range prefix {
+		if !strings.ContainsRune(base58Alphabet, c) {
+			return fmt.Errorf("prefix has %q, which is not a Base58 character (0, O, I and l are left out)", c)
+		}
+	}
+	if prefix[0] != '1' {
+		return fmt.Errorf("addresses always start with 1")
+	}
+	if math.IsInf(VanityDifficulty(prefix), 1) {
+		return fmt.Errorf("no address starts with %s", prefix)
+	}
+	return nil
+}
+
+// VanityDifficulty is about how many keys have to be tried to find an
+// address starting with prefix. Addresses encode a 25 byte number, so
+// their second character is far from uniform: it is worked out from how
+// many of the numbers after the version byte start with the rest of the
+// prefix.
+func VanityDifficulty(prefix string) float64 {
+	rest := prefix[1:]
+	zeros := len(rest) - len(strings.TrimLeft(rest, "1"))
+	digits := rest[zeros:]
+	size := 1 + ripemd160.Size + ChecksumLength - 1
+
+	// Each further 1 is one more leading zero byte.
+	lower := new(big.Int).Lsh(big.NewInt(1), uint(8*(size-zeros-1)))
+	upper := new(big.Int).Lsh(lower, 8)
+	if digits == "" {
+		lower.SetInt64(0)
+	}
+
+	// Count the numbers with exactly that many zero bytes whose Base58
+	// digits start with the others.
+	matching := new(big.Int)
+	if digits != "" {
+		start := new(big.Int)
+		for _, c := range digits {
+			start.Mul(start, big.NewInt(58))
+			start.Add(start, big.NewInt(int64(strings.IndexRune(base58Alphabet, c))))
+		}
+		end := new(big.Int).Add(start, big.NewInt(1))
+		for start.Cmp(upper) < 0 {
+			from, to := maxInt(start, lower), minInt(end, upper)
+			if from.Cmp(to) < 0 {
+				matching.Add(matching, new(big.Int).Sub(to, from))
+			}
+			start.Mul(start, big.NewInt(58))
+			end.Mul(end, big.NewInt(58))
+		}
+	} else {
+		matching.Set(upper)
+	}
+	if matching.Sign() == 0 {
+		return math.Inf(1)
+	}
+
+	total := new(big.Int).Lsh(big.NewInt(1), uint(8*size))
+	difficulty, _ := new(big.Float).Quo(new(big.Float).SetInt(total), new(big.Float).SetInt(matching)).Float64()
+	return difficulty
+}
+
+func maxInt(a, b *big.Int) *big.Int {
+	if a.Cmp(b) > 0 {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b *big.Int) *big.Int {
+	if a.Cmp(b) < 0 {
+		return a
+	}
+	return b
+}
+
+// VanitySearch generates P-256 keys until one has an address starting with
+// Prefix.
+type VanitySearch struct {
+	Prefix string
+	tried  uint64
+}
+
+// Tried counts the keys generated so far. It can be called while Run is
+// searching.
+func (s *VanitySearch) Tried() uint64 {
+	return atomic.LoadUint64(&s.tried)
+}
+
+// Run searches with the given number of workers and returns the first wallet
+// found.
+func (s *VanitySearch) Run(workers int) *Wallet {
+	if workers < 1 {
+		workers = 1
+	}
+	found := make(chan *Wallet, workers)
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				privateKey, publicKey := NewKeyPair()
+				w := &Wallet{P256, scalarBytes(privateKey.D), publicKey, nil, nil, false}
+				atomic.AddUint64(&s.tried, 1)
+				if strings.HasPrefix(string(w.Address()), s.Prefix) {
+					found <- w
+					return
+				}
+			}
+		}()
+	}
+
+	w := <-found
+	close(done)
+	wg.Wait()
+	return w
+}
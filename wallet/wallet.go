@@ -8,29 +8,53 @@ import (
 	"crypto/sha256"
 	"log"
 
+	"github.com/mr-tron/base58"
 	"golang.org/x/crypto/ripemd160"
 )
 
 const (
 	ChecksumLength = 4
 
-	// hexadecimal representation of 0
+	// hexadecimal representation of 0, the version of P-256 addresses
 	Version = byte(0x00)
 )
 
 type Wallet struct {
-	// ecdsa = elliptic curve digital signature algorithm
-	PrivateKey ecdsa.PrivateKey
+	Type KeyType
+
+	// PrivateKey is the raw key: the private scalar for P-256 and Schnorr
+	// keys, the seed for ed25519 keys. It is empty while an encrypted
+	// wallet is locked.
+	PrivateKey []byte
 
 	PublicKey []byte
+
+	// EncryptedKey is the sealed private key of an encrypted wallet.
+	EncryptedKey []byte
+
+	// Path is where the key was derived from the seed, empty for keys that
+	// were generated on their own.
+	Path []uint32
+
+	// Change is set on keys generated to receive the change of a payment.
+	Change bool
 }
 
 func MakeWallet() *Wallet {
 	privateKey, publicKey := NewKeyPair()
-	wallet := Wallet{privateKey, publicKey}
+	wallet := Wallet{P256, scalarBytes(privateKey.D), publicKey, nil, nil, false}
 	return &wallet
 }
 
+func MakeWalletOfType(keyType KeyType) (*Wallet, error) {
+	privateKey, publicKey, err := newKeyPair(keyType)
+	if err != nil {
+		return nil, err
+	}
+	wallet := Wallet{keyType, privateKey, publicKey, nil, nil, false}
+	return &wallet, nil
+}
+
 func NewKeyPair() (ecdsa.PrivateKey, []byte) {
 	curve := elliptic.P256()
 
@@ -39,7 +63,7 @@ func NewKeyPair() (ecdsa.PrivateKey, []byte) {
 		log.Panic(err)
 	}
 
-	pub := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+	pub := EncodePublicKey(&private.PublicKey)
 
 	return *private, pub
 }
@@ -67,8 +91,12 @@ func Checksum(ripeMdHash []byte) []byte {
 func (w *Wallet) Address() []byte {
 	// Step 1/2
 	pubHash := PublicKeyHash(w.PublicKey)
+	return encodeAddress(w.Type.Version(), pubHash)
+}
+
+func encodeAddress(version byte, pubHash []byte) []byte {
 	//Step 3
-	versionedHash := append([]byte{Version}, pubHash...)
+	versionedHash := append([]byte{version}, pubHash...)
 	//Step 4
 	checksum := Checksum(versionedHash)
 	//Step 5
@@ -79,11 +107,14 @@ func (w *Wallet) Address() []byte {
 }
 
 func ValidateAddress(address string) bool {
-	pubKeyHash := Base58Decode([]byte(address))
+	pubKeyHash, err := base58.Decode(address)
+	if err != nil || len(pubKeyHash) <= 1+ChecksumLength {
+		return false
+	}
 	actualChecksum := pubKeyHash[len(pubKeyHash)-ChecksumLength:]
 	version := pubKeyHash[0]
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-ChecksumLength]
 	targetChecksum := Checksum(append([]byte{version}, pubKeyHash...))
 
-	return bytes.Equal(targetChecksum, actualChecksum)
+	return bytes.Equal(targetChecksum, actualChecksum) && KeyType(version).IsValid()
 }
@@ -2,11 +2,12 @@ package wallet
 
 import (
 	"bytes"
-	"crypto/elliptic"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"os"
 )
 
@@ -14,21 +15,54 @@ const walletFile = "./tmp/wallets_%s.data"
 
 type Wallets struct {
 	Wallets map[string]*Wallet
+
+	// Encryption is set once the private keys are encrypted.
+	Encryption *Encryption
+
+	// HD is the seed the P-256 keys are derived from.
+	HD *HDChain
+
+	// WatchOnly holds the addresses tracked without their keys.
+	WatchOnly map[string]*WatchOnly
+
+	// History is what the wallet sent and received. It is kept in a file
+	// of its own, which the node rewrites after every block; wallet files
+	// written before that may still hold it.
+	History *History
+
+	// Contacts is the address book by name.
+	Contacts map[string]*Contact
+
+	masterKey []byte
 }
 
 func (ws *Wallets) SaveFile(nodeId string) {
 	var content bytes.Buffer
 	walletFile := fmt.Sprintf(walletFile, nodeId)
 
-	gob.Register(elliptic.P256())
+	stored := &Wallets{Wallets: ws.Wallets, Encryption: ws.Encryption, HD: ws.HD, WatchOnly: ws.WatchOnly, Contacts: ws.Contacts}
+	if ws.IsEncrypted() {
+		// Only the sealed keys of an encrypted wallet reach the disk.
+		stored.Wallets = make(map[string]*Wallet)
+		for address, w := range ws.Wallets {
+			entry := *w
+			entry.PrivateKey = nil
+			stored.Wallets[address] = &entry
+		}
+		if ws.HasHDChain() {
+			hd := *ws.HD
+			hd.Mnemonic = ""
+			stored.HD = &hd
+		}
+	}
 
 	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(ws)
+	err := encoder.Encode(stored)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
+	err = writePrivateFile(walletFile, content.Bytes())
 	if err != nil {
 		log.Panic(err)
 	}
@@ -47,18 +81,71 @@ func (ws *Wallets) LoadFile(nodeId string) error {
 		return err
 	}
 
-	gob.Register(elliptic.P256())
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
 	err = decoder.Decode(&wallets)
 	if err != nil {
-		return err
+		legacy, legacyErr := decodeLegacyWallets(fileContent)
+		if legacyErr != nil {
+			return err
+		}
+		wallets = *legacy
 	}
 
 	ws.Wallets = wallets.Wallets
+	ws.Encryption = wallets.Encryption
+	ws.HD = wallets.HD
+	ws.WatchOnly = wallets.WatchOnly
+	ws.History = wallets.History
+	ws.Contacts = wallets.Contacts
+	ws.loadHistory(nodeId)
+	if ws.IsEncrypted() {
+		ws.loadSession(nodeId)
+	}
 
 	return nil
 }
 
+// legacyWallets is the wallet file written before key types existed, when
+// a wallet was a gob encoded ecdsa.PrivateKey and the bare X and Y of its
+// public key.
+type legacyWallets struct {
+	Wallets map[string]*legacyWallet
+}
+
+type legacyWallet struct {
+	PrivateKey legacyPrivateKey
+	PublicKey  []byte
+}
+
+// legacyPrivateKey takes the private scalar out of an ecdsa.PrivateKey. Its
+// public key, which holds the curve as an interface, is skipped.
+type legacyPrivateKey struct {
+	D *big.Int
+}
+
+// decodeLegacyWallets reads a wallet file of the legacy format into P-256
+// wallets. They keep their public key as it was, so their addresses do not
+// change.
+func decodeLegacyWallets(data []byte) (*Wallets, error) {
+	var legacy legacyWallets
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&legacy); err != nil {
+		return nil, err
+	}
+
+	wallets := &Wallets{Wallets: make(map[string]*Wallet)}
+	for address, lw := range legacy.Wallets {
+		if lw.PrivateKey.D == nil {
+			return nil, fmt.Errorf("legacy wallet %s has no private key", address)
+		}
+		w := &Wallet{P256, scalarBytes(lw.PrivateKey.D), lw.PublicKey, nil, nil, false}
+		if string(w.Address()) != address {
+			return nil, fmt.Errorf("legacy wallet %s does not match its key", address)
+		}
+		wallets.Wallets[address] = w
+	}
+	return wallets, nil
+}
+
 func CreateWallets(nodeId string) (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
@@ -67,13 +154,66 @@ func CreateWallets(nodeId string) (*Wallets, error) {
 	return &wallets, err
 }
 
-func (ws *Wallets) AddWallet() string {
-	wallet := MakeWallet()
+func (ws *Wallets) AddWallet(keyType KeyType) (string, error) {
+	wallet, err := MakeWalletOfType(keyType)
+	if err != nil {
+		return "", err
+	}
+	return ws.insert(wallet)
+}
+
+// ImportWallet adds a key that was made elsewhere.
+func (ws *Wallets) ImportWallet(wallet *Wallet) (string, error) {
+	address := string(wallet.Address())
+	if _, ok := ws.Wallets[address]; ok {
+		return address, errors.New("key is already in the wallet")
+	}
+	address, err := ws.insert(wallet)
+	if err == nil {
+		// The address no longer needs to be watched on its own.
+		delete(ws.WatchOnly, address)
+	}
+	return address, err
+}
+
+// insert stores a new key, sealing it first if the wallet is encrypted.
+func (ws *Wallets) insert(wallet *Wallet) (string, error) {
+	if ws.IsLocked() {
+		return "", ErrWalletLocked
+	}
+	if ws.IsEncrypted() {
+		if err := wallet.encrypt(ws.masterKey); err != nil {
+			return "", err
+		}
+	}
 	address := fmt.Sprintf("%s", wallet.Address())
 
 	ws.Wallets[address] = wallet
 
-	return address
+	return address, nil
+}
+
+// NewChangeAddress adds a fresh key to receive the change of a payment made
+// by from, so that payments are not linked through a reused address. Keys
+// derived from the seed get the next key of the change chain of their
+// account, other keys a new key of their own type.
+func (ws *Wallets) NewChangeAddress(from *Wallet) (string, error) {
+	if len(from.Path) == 5 && ws.HasHDChain() {
+		return ws.NextAddress(from.Path[2]-HardenedKeyStart, ChangeChain)
+	}
+
+	wallet, err := MakeWalletOfType(from.Type)
+	if err != nil {
+		return "", err
+	}
+	wallet.Change = true
+	return ws.insert(wallet)
+}
+
+// IsChange tells whether an address of the wallet receives change.
+func (ws *Wallets) IsChange(address string) bool {
+	w, ok := ws.Wallets[address]
+	return ok && w.IsChange()
 }
 
 func (ws Wallets) GetWallet(address string) Wallet {
@@ -86,5 +226,8 @@ func (ws *Wallets) GetAllAddresses() []string {
 	for address := range ws.Wallets {
 		addresses = append(addresses, address)
 	}
+	for address := range ws.WatchOnly {
+		addresses = append(addresses, address)
+	}
 	return addresses
 }
@@ -0,0 +1,88 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrWatchOnly = errors.New("address is watch-only, its private key is not in the wallet")
+
+// WatchOnly is an address the wallet tracks without holding its key.
+type WatchOnly struct {
+	Type       KeyType
+	PubKeyHash []byte
+
+	// PublicKey is empty when only the address was imported.
+	PublicKey []byte
+}
+
+func (w *WatchOnly) Address() []byte {
+	return encodeAddress(w.Type.Version(), w.PubKeyHash)
+}
+
+// PubKeyHashOf returns the public key hash an address pays to.
+func PubKeyHashOf(address string) ([]byte, error) {
+	if !ValidateAddress(address) {
+		return nil, errors.New("address is not valid")
+	}
+	pubKeyHash := Base58Decode([]byte(address))
+	return pubKeyHash[1 : len(pubKeyHash)-ChecksumLength], nil
+}
+
+// WatchAddress adds an address to watch without its key.
+func (ws *Wallets) WatchAddress(address string) (*WatchOnly, error) {
+	pubKeyHash, err := PubKeyHashOf(address)
+	if err != nil {
+		return nil, err
+	}
+	version := Base58Decode([]byte(address))[0]
+	return ws.watch(&WatchOnly{KeyType(version), pubKeyHash, nil})
+}
+
+// WatchPublicKey adds the address of a public key to watch without its key.
+func (ws *Wallets) WatchPublicKey(publicKey []byte) (*WatchOnly, error) {
+	keyType, err := PublicKeyType(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return ws.watch(&WatchOnly{keyType, PublicKeyHash(publicKey), publicKey})
+}
+
+func (ws *Wallets) watch(w *WatchOnly) (*WatchOnly, error) {
+	address := string(w.Address())
+	if _, ok := ws.Wallets[address]; ok {
+		return nil, errors.New("the key of this address is already in the wallet")
+	}
+	if existing, ok := ws.WatchOnly[address]; ok {
+		// A public key can still be added to an address watched before.
+		if len(existing.PublicKey) > 0 || len(w.PublicKey) == 0 {
+			return nil, errors.New("address is already watched")
+		}
+	}
+
+	if ws.WatchOnly == nil {
+		ws.WatchOnly = make(map[string]*WatchOnly)
+	}
+	ws.WatchOnly[address] = w
+	return w, nil
+}
+
+func (ws *Wallets) IsWatchOnly(address string) bool {
+	_, ok := ws.WatchOnly[address]
+	return ok
+}
+
+// SigningWallet returns the wallet of an address that can sign right now.
+func (ws *Wallets) SigningWallet(address string) (*Wallet, error) {
+	if ws.IsWatchOnly(address) {
+		return nil, ErrWatchOnly
+	}
+	w, ok := ws.Wallets[address]
+	if !ok {
+		return nil, fmt.Errorf("address %s is not in the wallet", address)
+	}
+	if ws.IsLocked() {
+		return nil, ErrWalletLocked
+	}
+	return w, nil
+}